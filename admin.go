@@ -0,0 +1,72 @@
+package main
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/spf13/viper"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/ainghazal/torii/share"
+)
+
+const (
+	errForbiddenStr = "forbidden"
+)
+
+// bearerToken returns the token in the Authorization header, if any.
+func bearerToken(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+}
+
+// isAdmin returns true if the request carries the admin token set with the
+// admin_token key. If no admin token is configured, nobody is admin. The admin
+// can also change any shared experiment.
+func isAdmin(r *http.Request) bool {
+	token := viper.GetString("admin_token")
+	if token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(bearerToken(r)), []byte(token)) == 1
+}
+
+// requireAdmin wraps a handler so that it only runs for admin requests.
+func requireAdmin(next httpHandler) httpHandler {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !isAdmin(r) {
+			http.Error(w, errForbiddenStr, http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// requireEditor wraps a handler that changes the experiment in the path, so
+// that it only runs for requests with the edit token of the experiment, or
+// for admin requests.
+func requireEditor(db *bolt.DB, next func(http.ResponseWriter, *http.Request)) httpHandler {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if isAdmin(r) {
+			next(w, r)
+			return
+		}
+		err := share.CheckEditToken(db, getParam("uuid", r), bearerToken(r))
+		switch {
+		case share.IsNotFound(err):
+			http.Error(w, errNotFoundStr, http.StatusNotFound)
+		case share.IsForbidden(err):
+			http.Error(w, errForbiddenStr, http.StatusForbidden)
+		case err != nil:
+			log.Println("ERROR:", err)
+			http.Error(w, errorString(err), http.StatusInternalServerError)
+		default:
+			next(w, r)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+// Package archive keeps every rendered descriptor under the hash of its
+// content, so that measurements can be linked back to the exact descriptor
+// that a probe ran.
+package archive
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	descriptorsBucket = "descriptors"
+)
+
+var errNotFound = errors.New("descriptor not found")
+
+// Entry is an archived descriptor.
+type Entry struct {
+	Body    []byte    `json:"body"`
+	Created time.Time `json:"created"`
+}
+
+// Store persists descriptors in a bbolt bucket.
+type Store struct {
+	db *bolt.DB
+}
+
+// NewStore returns a Store backed by the passed database, creating the bucket
+// if needed.
+func NewStore(db *bolt.DB) (*Store, error) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(descriptorsBucket))
+		if err != nil {
+			return fmt.Errorf("create bucket: %s", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Store{db: db}, nil
+}
+
+// Hash returns the content hash of a descriptor, in hex.
+func Hash(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// Put stores the descriptor, if it's not stored already, and returns its
+// hash.
+func (s *Store) Put(body []byte) (string, error) {
+	hash := Hash(body)
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(descriptorsBucket))
+		if b.Get([]byte(hash)) != nil {
+			return nil
+		}
+		buf, err := json.Marshal(Entry{Body: body, Created: time.Now().UTC()})
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(hash), buf)
+	})
+	return hash, err
+}
+
+// Get returns the descriptor stored under hash.
+func (s *Store) Get(hash string) (*Entry, error) {
+	e := &Entry{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket([]byte(descriptorsBucket)).Get([]byte(hash))
+		if v == nil {
+			return errNotFound
+		}
+		return json.Unmarshal(v, e)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// IsNotFound returns true if the error means that there's no such
+// descriptor.
+func IsNotFound(err error) bool {
+	return errors.Is(err, errNotFound)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/ainghazal/torii/archive"
+)
+
+const (
+	headerDescriptor = "X-Torii-Descriptor"
+	paramHash        = "hash"
+)
+
+// descriptorStore keeps every rendered descriptor under its content hash. It
+// is nil if the store could not be initialized.
+var descriptorStore *archive.Store
+
+// encodeConfig returns the JSON encoding of the config, which is what we
+// hash and archive. It's the same as the body served in the json format.
+func encodeConfig(cfg *config) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	err := json.NewEncoder(buf).Encode(cfg)
+	return buf.Bytes(), err
+}
+
+// archiveConfig stores the config and returns its hash. It returns an empty
+// hash if there's no store.
+func archiveConfig(cfg *config) (string, error) {
+	if descriptorStore == nil {
+		return "", nil
+	}
+	body, err := encodeConfig(cfg)
+	if err != nil {
+		return "", err
+	}
+	return descriptorStore.Put(body)
+}
+
+// etagMatches returns true if the If-None-Match header of the request lists
+// the passed etag, with the weak comparison. "*" does not match: a client
+// cannot have a descriptor that was not rendered yet.
+func etagMatches(r *http.Request, etag string) bool {
+	for _, tag := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		if strings.TrimPrefix(strings.TrimSpace(tag), "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// archivedDescriptorHandler returns an archived descriptor by its hash. The
+// body is the same that was served in the json format, and so is the
+// signature.
+func archivedDescriptorHandler(w http.ResponseWriter, r *http.Request) {
+	if descriptorStore == nil {
+		http.Error(w, errNotFoundStr, http.StatusNotFound)
+		return
+	}
+	hash := getParam(paramHash, r)
+	entry, err := descriptorStore.Get(hash)
+	if archive.IsNotFound(err) {
+		http.Error(w, errNotFoundStr, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println("ERROR:", err)
+		http.Error(w, errorString(err), http.StatusInternalServerError)
+		return
+	}
+	etag := `"` + hash + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set(headerDescriptor, hash)
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	if etagMatches(r, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	buf := &bufferedResponse{w: w}
+	defer buf.flush()
+	buf.Header().Set("Content-Type", "application/json")
+	buf.Write(entry.Body)
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/ainghazal/torii/archive"
+	"github.com/ainghazal/torii/rules"
+	"github.com/ainghazal/torii/vpn"
+)
+
+// batchManifest describes a batch of descriptors written by the render
+// subcommand, with everything needed to render the same batch again.
+type batchManifest struct {
+	Generated time.Time   `json:"generated"`
+	Seed      int64       `json:"seed"`
+	Provider  string      `json:"provider,omitempty"`
+	Mix       string      `json:"mix,omitempty"`
+	Country   string      `json:"cc,omitempty"`
+	Strategy  string      `json:"strategy"`
+	Max       int         `json:"max,omitempty"`
+	Format    string      `json:"format"`
+	Snapshot  string      `json:"snapshot,omitempty"`
+	Files     []batchFile `json:"files"`
+}
+
+type batchFile struct {
+	File string `json:"file"`
+	// Descriptor is the content hash of the descriptor, as returned in
+	// the X-Torii-Descriptor header when served.
+	Descriptor string `json:"descriptor"`
+	Name       string `json:"name"`
+	Endpoints  int    `json:"endpoints"`
+	Signed     bool   `json:"signed"`
+}
+
+// fileResponse collects what a format writes, for the render subcommand.
+type fileResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (f *fileResponse) Header() http.Header {
+	return f.header
+}
+
+func (f *fileResponse) Write(p []byte) (int, error) {
+	return f.body.Write(p)
+}
+
+func (f *fileResponse) WriteHeader(status int) {
+	f.status = status
+}
+
+// runRender implements the render subcommand, which writes a batch of
+// descriptors to a directory, with the same selection logic as the server.
+// It returns the exit code.
+func runRender(args []string) int {
+	fs := flag.NewFlagSet("render", flag.ExitOnError)
+	provider := fs.String("provider", "", "provider to pick endpoints from")
+	mix := fs.String("mix", "", "draw from several providers instead, e.g. riseup:2,tunnelbear:1")
+	cc := fs.String("cc", "", "country code to restrict the pool to")
+	strategyName := fs.String("strategy", defaultStrategy, "selection strategy, see /vpn/strategies")
+	max := fs.Int("max", 0, "number of endpoints in each descriptor (default: the strategy default)")
+	count := fs.Int("count", 1, "number of descriptors to write")
+	seed := fs.Int64("seed", 0, "random seed (default: a random one, written to the manifest)")
+	formatName := fs.String("format", defaultFormat, "output format, see /vpn/formats")
+	out := fs.String("out", "descriptors", "directory to write the descriptors to")
+	snapshot := fs.String("snapshot", "", "load the providers from a snapshot instead of bootstrapping them")
+	writeSnapshot := fs.String("write-snapshot", "", "write a snapshot of the providers to this file")
+	dbPath := fs.String("db", "", "take the rules from (a copy of) the server database (default: the built-in rules)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: torii render -provider NAME [flags]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if (*provider == "") == (*mix == "") || *count < 1 {
+		fs.Usage()
+		return 2
+	}
+
+	loadConfig()
+	initSigner()
+	format, ok := formats[*formatName]
+	if !ok {
+		log.Printf("ERROR: unknown format: %q\n", *formatName)
+		return 2
+	}
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+	rand.Seed(*seed)
+
+	if *snapshot != "" {
+		s, err := vpn.LoadSnapshot(*snapshot)
+		if err != nil {
+			log.Println("ERROR: cannot load snapshot:", err)
+			return 1
+		}
+		s.Restore()
+		log.Printf("🌿 Loaded providers from snapshot taken at %s\n", s.Taken)
+	} else {
+		log.Println("🌿 Initializing all providers...")
+		if err := vpn.InitAllProviders(); err != nil {
+			log.Println("ERROR: cannot initialize providers:", err)
+			return 1
+		}
+	}
+	initGeoIP()
+	geoLocateAll()
+	if *writeSnapshot != "" {
+		if err := vpn.TakeSnapshot(vpn.Providers).Save(*writeSnapshot); err != nil {
+			log.Println("ERROR: cannot write snapshot:", err)
+			return 1
+		}
+	}
+	closeDB, err := openBatchRules(*dbPath)
+	if err != nil {
+		log.Println("ERROR: cannot load rules:", err)
+		return 1
+	}
+	defer closeDB()
+
+	params := strategyParams{CountryCode: *cc, Max: *max, Extra: url.Values{}}
+	if _, err := selectorForStrategy(*strategyName, params); err != nil {
+		log.Println("ERROR:", err)
+		return 2
+	}
+	render := func() (*config, error) {
+		if *mix != "" {
+			quotas, err := parseProviderQuotas(*mix)
+			if err != nil {
+				return nil, err
+			}
+			meta := newDescriptorMeta("", *cc, *strategyName)
+			return renderMixedConfig(quotas, mixedSelectorFor(*strategyName, params, nil), meta, nil)
+		}
+		p, ok := vpn.Providers[*provider]
+		if !ok {
+			return nil, fmt.Errorf("unknown provider: %q", *provider)
+		}
+		selector, _ := selectorForStrategy(*strategyName, params)
+		return renderConfigForProvider(p, selector, newDescriptorMeta(*provider, *cc, *strategyName), nil)
+	}
+
+	if err := os.MkdirAll(*out, 0755); err != nil {
+		log.Println("ERROR:", err)
+		return 1
+	}
+	manifest := &batchManifest{
+		Generated: time.Now().UTC(),
+		Seed:      *seed,
+		Provider:  *provider,
+		Mix:       *mix,
+		Country:   *cc,
+		Strategy:  *strategyName,
+		Max:       *max,
+		Format:    format.Name,
+		Snapshot:  *snapshot,
+		Files:     []batchFile{},
+	}
+	req, _ := http.NewRequest(http.MethodGet, "/", nil)
+	for i := 0; i < *count; i++ {
+		cfg, err := render()
+		if err != nil {
+			log.Println("ERROR:", err)
+			return 1
+		}
+		res := &fileResponse{header: make(http.Header)}
+		if err := format.render(res, req, cfg); err != nil || (res.status != 0 && res.status != http.StatusOK) {
+			log.Printf("ERROR: cannot write descriptor %d: %v %s\n", i+1, err, res.body.String())
+			return 1
+		}
+		ext := format.Name
+		if len(format.Extensions) != 0 {
+			ext = format.Extensions[0]
+		}
+		if res.header.Get("Content-Type") == contentTypeZip {
+			ext = "zip"
+		}
+		// the name comes from the metadata templates, so it's sanitized
+		name := profileFileName(ext, cfg.Name, fmt.Sprintf("%03d", i+1))
+		path, err := pathUnder(*out, name)
+		if err != nil {
+			log.Println("ERROR:", err)
+			return 1
+		}
+		if err := os.WriteFile(path, res.body.Bytes(), 0644); err != nil {
+			log.Println("ERROR:", err)
+			return 1
+		}
+		if signer != nil {
+			jws := signer.Sign(res.body.Bytes())
+			if err := os.WriteFile(path+".jws", []byte(jws+"\n"), 0644); err != nil {
+				log.Println("ERROR:", err)
+				return 1
+			}
+		}
+		body, _ := encodeConfig(cfg)
+		manifest.Files = append(manifest.Files, batchFile{
+			File:       name,
+			Descriptor: archive.Hash(body),
+			Name:       cfg.Name,
+			Endpoints:  len(cfg.NetTests),
+			Signed:     signer != nil,
+		})
+	}
+
+	data, _ := json.MarshalIndent(manifest, "", "  ")
+	if err := os.WriteFile(filepath.Join(*out, "manifest.json"), data, 0644); err != nil {
+		log.Println("ERROR:", err)
+		return 1
+	}
+	log.Printf("📦 Wrote %d descriptors to %s (seed %d)\n", *count, *out, *seed)
+	return 0
+}
+
+// openBatchRules loads the rules for the render subcommand, from the
+// database at path, or from a temporary database with the default rules if
+// path is empty. The server database is locked while the server runs, so a
+// copy must be used then. It returns a function to close the database.
+func openBatchRules(path string) (func(), error) {
+	cleanup := func() {}
+	if path == "" {
+		dir, err := os.MkdirTemp("", "torii-render")
+		if err != nil {
+			return nil, err
+		}
+		path = filepath.Join(dir, "rules.db")
+		cleanup = func() { os.RemoveAll(dir) }
+	}
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		cleanup()
+		return nil, err
+	}
+	ruleStore, err = rules.NewStore(db, defaultRules)
+	if err != nil {
+		db.Close()
+		cleanup()
+		return nil, err
+	}
+	return func() {
+		db.Close()
+		cleanup()
+	}, nil
+}
+
+// pathUnder joins dir and name, and returns an error if the result is not
+// inside dir.
+func pathUnder(dir, name string) (string, error) {
+	path := filepath.Join(dir, name)
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) || filepath.IsAbs(rel) {
+		return "", fmt.Errorf("file name %q leaves %s", name, dir)
+	}
+	return path, nil
+}
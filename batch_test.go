@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+
+	"github.com/ainghazal/torii/archive"
+	"github.com/ainghazal/torii/vpn"
+)
+
+func Test_runRender_snapshot(t *testing.T) {
+	saved, savedRules := vpn.Providers["riseup"], ruleStore
+	defer func() { vpn.Providers["riseup"], ruleStore = saved, savedRules }()
+
+	render := func() (*batchManifest, string) {
+		out := t.TempDir()
+		args := []string{
+			"-provider", "riseup", "-snapshot", filepath.Join("testdata", "snapshot.json"),
+			"-seed", "42", "-count", "3", "-max", "2", "-out", out,
+		}
+		if code := runRender(args); code != 0 {
+			t.Fatalf("runRender() = %d", code)
+		}
+		data, err := os.ReadFile(filepath.Join(out, "manifest.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		manifest := &batchManifest{}
+		if err := json.Unmarshal(data, manifest); err != nil {
+			t.Fatal(err)
+		}
+		return manifest, out
+	}
+
+	first, out := render()
+	second, _ := render()
+	if first.Seed != 42 || len(first.Files) != 3 {
+		t.Fatalf("manifest = %+v, want seed 42 and 3 files", first)
+	}
+	for i, f := range first.Files {
+		if f != second.Files[i] {
+			t.Errorf("file %d differs between runs: %+v, %+v", i, f, second.Files[i])
+		}
+		body, err := os.ReadFile(filepath.Join(out, f.File))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the json format writes the descriptor as archived
+		if got := archive.Hash(body); got != f.Descriptor {
+			t.Errorf("%s: hash = %s, manifest says %s", f.File, got, f.Descriptor)
+		}
+		if f.Endpoints != 2 {
+			t.Errorf("%s: %d endpoints, want 2", f.File, f.Endpoints)
+		}
+	}
+}
+
+func Test_runRender_nameTemplate(t *testing.T) {
+	saved, savedRules := vpn.Providers["riseup"], ruleStore
+	defer func() { vpn.Providers["riseup"], ruleStore = saved, savedRules }()
+	defer viper.Reset()
+	viper.Set("descriptor.name", "../../{{.Provider}}/evil")
+
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out")
+	args := []string{"-provider", "riseup", "-snapshot", filepath.Join("testdata", "snapshot.json"), "-seed", "1", "-out", out}
+	if code := runRender(args); code != 0 {
+		t.Fatalf("runRender() = %d", code)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "out" {
+		t.Errorf("runRender() wrote outside of -out: %v", entries)
+	}
+	if _, err := os.Stat(filepath.Join(out, "_._.._Riseup_VPN_evil-001.json")); err != nil {
+		t.Errorf("sanitized descriptor not found: %v", err)
+	}
+}
+
+func Test_pathUnder(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		wantErr bool
+	}{
+		{"plain", "a.json", false},
+		{"dots in the name", "a..b.json", false},
+		{"parent", "../a.json", true},
+		{"nested parent", "x/../../a.json", true},
+		{"dir itself", "..", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := pathUnder("out", tt.file); (err != nil) != tt.wantErr {
+				t.Errorf("pathUnder() err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
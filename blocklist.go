@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/ainghazal/torii/rules"
+	"github.com/ainghazal/torii/vpn"
+)
+
+// ruleStore holds the blocklist and allowlist rules. It is nil if the store
+// could not be initialized.
+var ruleStore *rules.Store
+
+// defaultRules are stored the first time the rule store is created.
+var defaultRules = []*rules.Rule{
+	{
+		Action:   rules.ActionDeny,
+		Provider: "riseup",
+		Port:     "53",
+		Reason:   "port 53 is proving to be problematic",
+	},
+}
+
+// rulesFilter returns a filter that applies the active rules to endpoints of
+// the passed provider.
+func rulesFilter(provider string) namedFilter {
+	if ruleStore == nil {
+		return namedFilter{name: "blocklist", match: nullFilter}
+	}
+	return namedFilter{
+		name: "blocklist",
+		match: func(e *vpn.Endpoint) bool {
+			ok, _ := ruleStore.Check(provider, e)
+			return ok
+		},
+		reason: func(e *vpn.Endpoint) string {
+			_, rule := ruleStore.Check(provider, e)
+			if rule == nil {
+				return "not in allowlist"
+			}
+			return fmt.Sprintf("rule %d: %s", rule.ID, rule.Reason)
+		},
+	}
+}
+
+func listRulesHandler(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(ruleStore.List())
+}
+
+func addRuleHandler(w http.ResponseWriter, r *http.Request) {
+	rule := &rules.Rule{}
+	if err := json.NewDecoder(r.Body).Decode(rule); err != nil {
+		http.Error(w, "bad json request", http.StatusBadRequest)
+		return
+	}
+	if err := ruleStore.Add(rule); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.Printf("🚧 Added %s rule %d: %s\n", rule.Action, rule.ID, rule.Reason)
+	json.NewEncoder(w).Encode(rule)
+}
+
+func deleteRuleHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(getParam("id", r))
+	if err != nil {
+		http.Error(w, errNotFoundStr, http.StatusNotFound)
+		return
+	}
+	err = ruleStore.Delete(id)
+	if rules.IsNotFound(err) {
+		http.Error(w, errNotFoundStr, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, errorString(err), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("🚧 Deleted rule %d\n", id)
+	w.WriteHeader(http.StatusNoContent)
+}
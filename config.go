@@ -2,6 +2,7 @@ package main
 
 import (
 	"log"
+	"strings"
 
 	"github.com/spf13/viper"
 )
@@ -17,6 +18,7 @@ func loadConfig() {
 	viper.SetConfigName(appName)
 	viper.SetConfigType("yaml")
 	viper.AddConfigPath(".")
+	viper.SetDefault("score_floor", defaultScoreFloor)
 
 	// not capturing error because config file is optional
 	_ = viper.ReadInConfig()
@@ -33,3 +35,21 @@ func serverName() string {
 	}
 	return sn.(string)
 }
+
+// publicURL returns the base url the server is reached at by clients, for
+// the links it hands out. It's the public_url key if set, or derived from
+// server_name. It never depends on the Host header of a request.
+func publicURL() string {
+	if u := viper.GetString("public_url"); u != "" {
+		return strings.TrimSuffix(u, "/")
+	}
+	scheme := "https"
+	if skipTLS() {
+		scheme = "http"
+	}
+	host := viper.GetString("server_name")
+	if host == "" {
+		host = "localhost" + listeningPort
+	}
+	return scheme + "://" + host
+}
@@ -0,0 +1,104 @@
+// Package coverage keeps track of how often, and when, each endpoint has
+// been served in a descriptor.
+package coverage
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	servedBucket = "served"
+)
+
+// Stat is the serving record for a single endpoint.
+type Stat struct {
+	Count      int       `json:"count"`
+	LastServed time.Time `json:"last_served"`
+}
+
+// Store persists serving stats in a bbolt bucket.
+type Store struct {
+	db *bolt.DB
+}
+
+// NewStore returns a Store backed by the passed database, creating the bucket
+// if needed.
+func NewStore(db *bolt.DB) (*Store, error) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(servedBucket))
+		if err != nil {
+			return fmt.Errorf("create bucket: %s", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Store{db: db}, nil
+}
+
+// Record increments the serving count for all the passed keys. A key
+// appearing several times is counted several times.
+func (s *Store) Record(keys []string) error {
+	now := time.Now().UTC()
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(servedBucket))
+		for _, k := range keys {
+			st := Stat{}
+			if v := b.Get([]byte(k)); v != nil {
+				if err := json.Unmarshal(v, &st); err != nil {
+					return err
+				}
+			}
+			st.Count++
+			st.LastServed = now
+			buf, err := json.Marshal(st)
+			if err != nil {
+				return err
+			}
+			if err := b.Put([]byte(k), buf); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Stats returns the stats for the passed keys. Keys that were never served
+// get a zero Stat.
+func (s *Store) Stats(keys []string) map[string]Stat {
+	stats := make(map[string]Stat, len(keys))
+	s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(servedBucket))
+		for _, k := range keys {
+			st := Stat{}
+			if v := b.Get([]byte(k)); v != nil {
+				json.Unmarshal(v, &st)
+			}
+			stats[k] = st
+		}
+		return nil
+	})
+	return stats
+}
+
+// WithPrefix returns the stats for all the keys starting with prefix.
+func (s *Store) WithPrefix(prefix string) map[string]Stat {
+	stats := make(map[string]Stat)
+	s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket([]byte(servedBucket)).Cursor()
+		for k, v := c.Seek([]byte(prefix)); k != nil && strings.HasPrefix(string(k), prefix); k, v = c.Next() {
+			st := Stat{}
+			if err := json.Unmarshal(v, &st); err == nil {
+				stats[string(k)] = st
+			}
+		}
+		return nil
+	})
+	return stats
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"github.com/ainghazal/torii/creds"
+	"github.com/ainghazal/torii/share"
+	"github.com/ainghazal/torii/vpn"
+)
+
+const (
+	paramCredentials = "credentials"
+	credentialsToken = "token"
+
+	credentialsPath = "/api/credentials"
+
+	defaultCredentialsTTL = 24 * time.Hour
+)
+
+// credStore keeps the tokens of secret-free descriptors. It is nil if the
+// store could not be initialized.
+var credStore *creds.Store
+
+var errNoCredStore = errors.New("no credentials store")
+
+// wantsCredentialTokens returns true if the descriptor must not carry the
+// provider secrets. This is the case if the credentials_mode key is "token",
+// or if the request (?credentials=token) or the experiment asks for it.
+func wantsCredentialTokens(r *http.Request, exp *share.Experiment) bool {
+	if viper.GetString("credentials_mode") == credentialsToken {
+		return true
+	}
+	if r.URL.Query().Get(paramCredentials) == credentialsToken {
+		return true
+	}
+	return exp != nil && exp.Credentials == credentialsToken
+}
+
+// credentialsURL returns the public url of the credentials endpoint. It goes
+// in signed descriptors, and probes send their tokens to it, so it never
+// depends on the Host header of a request.
+func credentialsURL() string {
+	return publicURL() + credentialsPath
+}
+
+// withoutSecrets replaces the client certificate and key in the options of
+// every nettest by a token to fetch them from credsURL. Each provider in the
+// descriptor gets its own token, valid for credentials_token_ttl. The CA is
+// not secret, and stays.
+func withoutSecrets(cfg *config, credsURL string) error {
+	if credStore == nil {
+		return errNoCredStore
+	}
+	ttl := viper.GetDuration("credentials_token_ttl")
+	if ttl <= 0 {
+		ttl = defaultCredentialsTTL
+	}
+	tokens := make(map[string]string)
+	for i := range cfg.NetTests {
+		opt := &cfg.NetTests[i].Options
+		if opt.SafeCert == "" && opt.SafeKey == "" {
+			continue
+		}
+		provider := cfg.selected[i].provider.Name()
+		if _, ok := tokens[provider]; !ok {
+			token, t, err := credStore.Issue(provider, ttl)
+			if err != nil {
+				return err
+			}
+			log.Printf("🔑 Issued credentials token %.8s for %s\n", t.ID, provider)
+			tokens[provider] = token
+		}
+		opt.SafeCert = ""
+		opt.SafeKey = ""
+		opt.CredentialsURL = credsURL
+		opt.CredentialsToken = tokens[provider]
+	}
+	return nil
+}
+
+// credentialsHandler returns the options of a provider, with its secrets, to
+// the bearer of a valid token for it.
+func credentialsHandler(w http.ResponseWriter, r *http.Request) {
+	if credStore == nil {
+		http.Error(w, errNotFoundStr, http.StatusNotFound)
+		return
+	}
+	t, err := credStore.Redeem(bearerToken(r))
+	if creds.IsNotFound(err) || creds.IsInvalid(err) {
+		http.Error(w, errForbiddenStr, http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		http.Error(w, errorString(err), http.StatusInternalServerError)
+		return
+	}
+	p, ok := vpn.Providers[t.Provider]
+	if !ok {
+		http.Error(w, errNotFoundStr, http.StatusNotFound)
+		return
+	}
+	log.Printf("🔑 Credentials for %s fetched with token %.8s (%d fetches)\n", t.Provider, t.ID, t.Fetches)
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(optionsForProvider(t.Provider, p.Auth()))
+}
+
+func listCredentialTokensHandler(w http.ResponseWriter, r *http.Request) {
+	if credStore == nil {
+		http.Error(w, errNotFoundStr, http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(credStore.List())
+}
+
+func revokeCredentialTokenHandler(w http.ResponseWriter, r *http.Request) {
+	if credStore == nil {
+		http.Error(w, errNotFoundStr, http.StatusNotFound)
+		return
+	}
+	id := getParam("id", r)
+	err := credStore.Revoke(id)
+	if creds.IsNotFound(err) {
+		http.Error(w, errNotFoundStr, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, errorString(err), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("🔑 Revoked credentials token %.8s\n", id)
+	w.WriteHeader(http.StatusNoContent)
+}
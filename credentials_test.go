@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/ainghazal/torii/creds"
+	"github.com/ainghazal/torii/vpn"
+)
+
+func Test_credentialsURL_forgedHost(t *testing.T) {
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "test.db"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	savedStore, savedProvider := credStore, vpn.Providers["riseup"]
+	defer func() { credStore, vpn.Providers["riseup"] = savedStore, savedProvider }()
+	if credStore, err = creds.NewStore(db); err != nil {
+		t.Fatal(err)
+	}
+	defer viper.Reset()
+	viper.Set("server_name", "example.org")
+
+	s := &vpn.Snapshot{Providers: []vpn.ProviderSnapshot{{
+		Name:      "riseup",
+		Auth:      vpn.AuthDetails{Ca: "ca", Cert: "cert", Key: "key"},
+		Endpoints: []*vpn.Endpoint{{IP: "192.0.2.1", Port: "1194", Proto: "openvpn", Transport: "tcp", Obfuscation: "none"}},
+	}}}
+	s.Restore()
+
+	r := httptest.NewRequest(http.MethodGet, "/vpn/mix.json?providers=riseup:1&credentials=token", nil)
+	r.Host = "attacker.example"
+	w := httptest.NewRecorder()
+	mixedEndpointDescriptor(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	cfg := &config{}
+	if err := json.NewDecoder(w.Body).Decode(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.NetTests) != 1 {
+		t.Fatalf("got %d nettests, want 1", len(cfg.NetTests))
+	}
+	want := "https://example.org" + credentialsPath
+	for _, nt := range cfg.NetTests {
+		if got := nt.Options.CredentialsURL; got != want {
+			t.Errorf("CredentialsURL = %q, want %q", got, want)
+		}
+		if nt.Options.CredentialsToken == "" {
+			t.Errorf("no credentials token in the descriptor")
+		}
+	}
+}
@@ -0,0 +1,166 @@
+// Package creds issues short-lived tokens that let a probe fetch the
+// credentials of a provider, so that descriptors do not need to carry them.
+package creds
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	tokensBucket = "credentials"
+
+	tokenBytes = 32
+)
+
+var (
+	errNotFound = errors.New("token not found")
+	errExpired  = errors.New("token expired")
+	errRevoked  = errors.New("token revoked")
+)
+
+// Token is the record of an issued token. The token itself is never stored:
+// the ID is its hash.
+type Token struct {
+	ID        string    `json:"id"`
+	Provider  string    `json:"provider"`
+	Created   time.Time `json:"created"`
+	Expires   time.Time `json:"expires"`
+	Revoked   bool      `json:"revoked"`
+	Fetches   int       `json:"fetches"`
+	LastFetch time.Time `json:"last_fetch,omitempty"`
+}
+
+// Store persists tokens in a bbolt bucket.
+type Store struct {
+	db *bolt.DB
+}
+
+// NewStore returns a Store backed by the passed database, creating the bucket
+// if needed.
+func NewStore(db *bolt.DB) (*Store, error) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(tokensBucket))
+		if err != nil {
+			return fmt.Errorf("create bucket: %s", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Store{db: db}, nil
+}
+
+// tokenID returns the id under which a token is stored.
+func tokenID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Issue returns a new token for the credentials of provider, valid for ttl.
+func (s *Store) Issue(provider string, ttl time.Duration) (string, *Token, error) {
+	raw := make([]byte, tokenBytes)
+	if _, err := rand.Read(raw); err != nil {
+		return "", nil, err
+	}
+	token := hex.EncodeToString(raw)
+	now := time.Now().UTC()
+	t := &Token{
+		ID:       tokenID(token),
+		Provider: provider,
+		Created:  now,
+		Expires:  now.Add(ttl),
+	}
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		return put(tx, t)
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return token, t, nil
+}
+
+// Redeem checks that the token is valid, and counts a fetch for it.
+func (s *Store) Redeem(token string) (*Token, error) {
+	t := &Token{}
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		if err := get(tx, tokenID(token), t); err != nil {
+			return err
+		}
+		if t.Revoked {
+			return errRevoked
+		}
+		now := time.Now().UTC()
+		if now.After(t.Expires) {
+			return errExpired
+		}
+		t.Fetches++
+		t.LastFetch = now
+		return put(tx, t)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Revoke revokes the token with the passed id.
+func (s *Store) Revoke(id string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		t := &Token{}
+		if err := get(tx, id, t); err != nil {
+			return err
+		}
+		t.Revoked = true
+		return put(tx, t)
+	})
+}
+
+// List returns all the tokens, including the expired and revoked ones.
+func (s *Store) List() []*Token {
+	tokens := []*Token{}
+	s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(tokensBucket)).ForEach(func(k, v []byte) error {
+			t := &Token{}
+			if err := json.Unmarshal(v, t); err == nil {
+				tokens = append(tokens, t)
+			}
+			return nil
+		})
+	})
+	return tokens
+}
+
+func get(tx *bolt.Tx, id string, t *Token) error {
+	v := tx.Bucket([]byte(tokensBucket)).Get([]byte(id))
+	if v == nil {
+		return errNotFound
+	}
+	return json.Unmarshal(v, t)
+}
+
+func put(tx *bolt.Tx, t *Token) error {
+	buf, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket([]byte(tokensBucket)).Put([]byte(t.ID), buf)
+}
+
+// IsNotFound returns true if the error means that there's no such token.
+func IsNotFound(err error) bool {
+	return errors.Is(err, errNotFound)
+}
+
+// IsInvalid returns true if the token exists, but it expired or was revoked.
+func IsInvalid(err error) bool {
+	return errors.Is(err, errExpired) || errors.Is(err, errRevoked)
+}
@@ -0,0 +1,58 @@
+package creds
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func newTestStore(t *testing.T) *Store {
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "test.db"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	s, err := NewStore(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestStore_Redeem(t *testing.T) {
+	s := newTestStore(t)
+
+	token, issued, err := s.Issue("riseup", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, _, _ := s.Issue("riseup", -time.Hour)
+	revoked, r, _ := s.Issue("riseup", time.Hour)
+	if err := s.Revoke(r.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 1; i <= 2; i++ {
+		got, err := s.Redeem(token)
+		if err != nil {
+			t.Fatalf("Redeem() error = %v", err)
+		}
+		if got.ID != issued.ID || got.Provider != "riseup" || got.Fetches != i {
+			t.Errorf("Redeem() = %+v, want %d fetches of %s", got, i, issued.ID)
+		}
+	}
+	if _, err := s.Redeem(expired); !IsInvalid(err) {
+		t.Errorf("Redeem(expired) error = %v", err)
+	}
+	if _, err := s.Redeem(revoked); !IsInvalid(err) {
+		t.Errorf("Redeem(revoked) error = %v", err)
+	}
+	if _, err := s.Redeem("nope"); !IsNotFound(err) {
+		t.Errorf("Redeem(unknown) error = %v", err)
+	}
+	if err := s.Revoke("nope"); !IsNotFound(err) {
+		t.Errorf("Revoke(unknown) error = %v", err)
+	}
+}
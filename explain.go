@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/ainghazal/torii/vpn"
+)
+
+// paramExplain asks a descriptor route for the selection trace, next to the
+// config: the filter that removed each excluded endpoint, and every random
+// draw.
+const paramExplain = "explain"
+
+// selectionTrace records the decisions taken while selecting endpoints. All
+// its methods are no-ops on a nil trace, so that selectors can record
+// unconditionally.
+type selectionTrace struct {
+	Candidates []*traceCandidate `json:"candidates"`
+	Draws      []traceDraw       `json:"draws"`
+
+	index map[string]*traceCandidate
+}
+
+type traceCandidate struct {
+	Provider    string  `json:"provider"`
+	Endpoint    string  `json:"endpoint"`
+	Label       string  `json:"label"`
+	CountryCode string  `json:"cc"`
+	ExcludedBy  string  `json:"excluded_by,omitempty"`
+	Reason      string  `json:"reason,omitempty"`
+	Weight      float64 `json:"weight,omitempty"`
+}
+
+type traceDraw struct {
+	Provider string  `json:"provider"`
+	Kind     string  `json:"kind"`
+	Endpoint string  `json:"endpoint"`
+	Pool     int     `json:"pool,omitempty"`
+	Roll     float64 `json:"roll,omitempty"`
+	Note     string  `json:"note,omitempty"`
+}
+
+// traceFor returns a new trace if the request asks for explain mode, and nil
+// otherwise.
+func traceFor(r *http.Request) *selectionTrace {
+	switch r.URL.Query().Get(paramExplain) {
+	case "1", "true", "yes":
+		return &selectionTrace{index: make(map[string]*traceCandidate)}
+	}
+	return nil
+}
+
+func traceEndpoint(e *vpn.Endpoint) string {
+	return fmt.Sprintf("%s/%s", net.JoinHostPort(e.IP, e.Port), e.Transport)
+}
+
+func (tr *selectionTrace) candidate(provider string, e *vpn.Endpoint) *traceCandidate {
+	key := endpointKey(provider, e)
+	if c, ok := tr.index[key]; ok {
+		return c
+	}
+	c := &traceCandidate{
+		Provider:    provider,
+		Endpoint:    traceEndpoint(e),
+		Label:       e.Label,
+		CountryCode: e.CountryCode,
+	}
+	tr.index[key] = c
+	tr.Candidates = append(tr.Candidates, c)
+	return c
+}
+
+// include records an endpoint that passed all the filters.
+func (tr *selectionTrace) include(provider string, e *vpn.Endpoint) {
+	if tr == nil {
+		return
+	}
+	tr.candidate(provider, e)
+}
+
+// exclude records an endpoint that was removed by the named filter.
+func (tr *selectionTrace) exclude(provider string, e *vpn.Endpoint, filter, reason string) {
+	if tr == nil {
+		return
+	}
+	c := tr.candidate(provider, e)
+	c.ExcludedBy = filter
+	c.Reason = reason
+}
+
+// weigh records the selection weight of a candidate.
+func (tr *selectionTrace) weigh(provider string, e *vpn.Endpoint, weight float64) {
+	if tr == nil {
+		return
+	}
+	tr.candidate(provider, e).Weight = weight
+}
+
+// draw records a random (or deterministic) choice made during selection.
+func (tr *selectionTrace) draw(d traceDraw) {
+	if tr == nil {
+		return
+	}
+	tr.Draws = append(tr.Draws, d)
+}
+
+type explainedConfig struct {
+	Config  *config         `json:"config"`
+	Explain *selectionTrace `json:"explain"`
+	Error   string          `json:"error,omitempty"`
+}
+
+// writeJSONConfig writes the rendered config, or the error that prevented
+// rendering it. In explain mode, the trace is written next to the config,
+// even when rendering failed.
+func writeJSONConfig(w http.ResponseWriter, r *http.Request, cfg *config, err error, tr *selectionTrace) {
+	if tr != nil {
+		res := &explainedConfig{Config: cfg, Explain: tr}
+		if err != nil {
+			res.Error = err.Error()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(res)
+		return
+	}
+	if err != nil {
+		http.Error(w, errorString(err), http.StatusGatewayTimeout)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cfg)
+}
@@ -3,87 +3,170 @@ package main
 import (
 	"fmt"
 	"log"
-	"math/rand"
 	"net"
 	"net/netip"
+	"strconv"
 
+	"github.com/ainghazal/torii/share"
 	"github.com/ainghazal/torii/vpn"
 )
 
-type endpointSelectorFn func(vpn.Provider) []*vpn.Endpoint
+type endpointSelectorFn func(vpn.Provider, *selectionTrace) []*vpn.Endpoint
 type providerFilterFn func(*vpn.Endpoint) bool
 
+// namedFilter is a filter with a name, so that we can tell which filter
+// excluded an endpoint. The optional reason function gives more detail.
+type namedFilter struct {
+	name   string
+	match  providerFilterFn
+	reason func(*vpn.Endpoint) string
+}
+
 func nullFilter(*vpn.Endpoint) bool {
 	return true
 }
 
-func healthyFilter(provider string) providerFilterFn {
-	hs, ok := healthServiceMap[provider]
-	if !ok {
-		return nullFilter
+// endpointTCPAddr returns the address of the endpoint in the form expected
+// by the health checker.
+func endpointTCPAddr(endp *vpn.Endpoint) (*net.TCPAddr, error) {
+	addrPort, err := netip.ParseAddrPort(net.JoinHostPort(endp.IP, endp.Port))
+	if err != nil {
+		return nil, err
 	}
-	return func(endp *vpn.Endpoint) bool {
-		addrStr := fmt.Sprintf("%s:%s", endp.IP, endp.Port)
-		addr := net.TCPAddrFromAddrPort(netip.MustParseAddrPort(addrStr))
-		healthy, err := hs.Healthy(addr, endp.Transport)
-		if err != nil {
-			log.Println("ERROR:", err)
-			return true
+	return net.TCPAddrFromAddrPort(addrPort), nil
+}
+
+// candidateEndpoints returns the endpoints of the provider that pass the
+// active rules, the health policy of the provider and all the passed
+// filters. Excluded endpoints are recorded in the trace, together with the
+// first filter that removed them.
+func candidateEndpoints(p vpn.Provider, filters []namedFilter, tr *selectionTrace) []*vpn.Endpoint {
+	all := append([]namedFilter{rulesFilter(p.Name()), healthPolicyFilter(p)}, filters...)
+	sel := []*vpn.Endpoint{}
+outer:
+	for _, endp := range p.Endpoints() {
+		for _, f := range all {
+			if f.match(endp) {
+				continue
+			}
+			reason := ""
+			if f.reason != nil {
+				reason = f.reason(endp)
+			}
+			tr.exclude(p.Name(), endp, f.name, reason)
+			continue outer
 		}
-		return healthy
+		tr.include(p.Name(), endp)
+		sel = append(sel, endp)
 	}
+	return sel
 }
 
-// filterAndRandomizeEndpointPicker accepts a provider, a boolean filter, and
+// filterAndRandomizeEndpointPicker accepts a provider, a list of filters, and
 // an integer indicating the maximum number of desired results. It
 // will return an array of pointers to vpn.Endpoint structs, chosen pseudo-randomly after
-// applying the passed filter to the list of all endpoints for that provider.
-func filterAndRandomizeEndpointsPicker(p vpn.Provider, filter providerFilterFn, max int) (res []*vpn.Endpoint) {
-	all := p.Endpoints()
-	if len(all) == 0 {
-		return nil
-	}
-	sel := []*vpn.Endpoint{}
-	healthy := healthyFilter(p.Name())
-	for _, endp := range all {
-		if filter(endp) && healthy(endp) {
-			sel = append(sel, endp)
-		}
-	}
+// applying the passed filters to the list of all endpoints for that provider.
+// Endpoints excluded by the active rules or by the health policy of the
+// provider are never picked, and each pick is weighted by the health score of
+// the endpoint (see score.go).
+func filterAndRandomizeEndpointsPicker(p vpn.Provider, filters []namedFilter, max int, tr *selectionTrace) (res []*vpn.Endpoint) {
+	sel := candidateEndpoints(p, filters, tr)
 	if len(sel) == 0 {
 		return res
 	}
+	weight := healthWeight(p.Name())
+	weights := make([]float64, len(sel))
+	for i, endp := range sel {
+		weights[i] = weight(endp)
+		tr.weigh(p.Name(), endp, weights[i])
+	}
 	for i := 0; i < max; i++ {
-		pick := rand.Intn(len(sel))
-		log.Printf("🎲 Picked endpoint %d/%d\n", pick+1, len(sel))
+		pick, roll := weightedPick(weights)
+		log.Printf("🎲 Picked endpoint %d/%d (weight %.2f)\n", pick+1, len(sel), weights[pick])
+		tr.draw(traceDraw{
+			Provider: p.Name(),
+			Kind:     "weighted",
+			Endpoint: traceEndpoint(sel[pick]),
+			Pool:     len(sel),
+			Roll:     roll,
+		})
 		res = append(res, sel[pick])
 	}
 	return res
 }
 
 // randomEndpointPicker returns a provider selector that picks one random
-// endpoint.
-func randomEndpointPicker() endpointSelectorFn {
-	all := func(e *vpn.Endpoint) bool {
-		return true
-	}
+// endpoint, among the ones matched by the optional extra filters.
+func randomEndpointPicker(extra ...namedFilter) endpointSelectorFn {
 	// curry filterAndRandomizeEndpointPicker
-	return func(p vpn.Provider) []*vpn.Endpoint {
-		return filterAndRandomizeEndpointsPicker(p, all, 1)
+	return func(p vpn.Provider, tr *selectionTrace) []*vpn.Endpoint {
+		return filterAndRandomizeEndpointsPicker(p, extra, 1, tr)
 	}
 }
 
-// byCountryEndpointPicker returns a provider selector that picks a number max
-// of endpoints after filtering by country code.
-func byCountryEndpointPicker(cc string, max int) endpointSelectorFn {
-	filterByCC := func(e *vpn.Endpoint) bool {
-		if e.CountryCode == cc {
-			return true
-		}
-		return false
+// byCountryFilter returns a filter that matches endpoints in the country cc.
+// An empty cc, or "any", matches all the endpoints.
+func byCountryFilter(cc string) namedFilter {
+	if cc == "" || cc == "any" {
+		return namedFilter{name: "country", match: nullFilter}
+	}
+	return namedFilter{
+		name: "country",
+		match: func(e *vpn.Endpoint) bool {
+			return e.CountryCode == cc
+		},
+		reason: func(e *vpn.Endpoint) string {
+			return fmt.Sprintf("%s != %s", e.CountryCode, cc)
+		},
 	}
+}
+
+// byCountryEndpointPicker returns a provider selector that picks a number max
+// of endpoints after filtering by country code and the optional extra filters.
+func byCountryEndpointPicker(cc string, max int, extra ...namedFilter) endpointSelectorFn {
+	filters := append([]namedFilter{byCountryFilter(cc)}, extra...)
 	// curry filterAndRandomizeEndpointPicker
-	return func(p vpn.Provider) []*vpn.Endpoint {
-		return filterAndRandomizeEndpointsPicker(p, filterByCC, max)
+	return func(p vpn.Provider, tr *selectionTrace) []*vpn.Endpoint {
+		return filterAndRandomizeEndpointsPicker(p, filters, max, tr)
+	}
+}
+
+// withRandomPorts wraps a selector so that every selected endpoint gets a
+// random port according to the passed policy. The ports the ref provider is
+// known to accept are used if the policy has no explicit range or set. The
+// active rules are applied again to the new port, and an endpoint keeps its
+// own port if the policy has no allowed port for it. Endpoints are copied, so
+// that the provider pool is left untouched.
+func withRandomPorts(selector endpointSelectorFn, policy *share.PortPolicy, ref vpn.Provider) endpointSelectorFn {
+	if policy == nil {
+		return selector
+	}
+	return func(p vpn.Provider, tr *selectionTrace) []*vpn.Endpoint {
+		known := vpn.KnownPorts(ref)
+		res := []*vpn.Endpoint{}
+		for _, e := range selector(p, tr) {
+			endp := e.Copy()
+			allowed := func(port int) bool {
+				if ruleStore == nil {
+					return true
+				}
+				candidate := *endp
+				candidate.Port = strconv.Itoa(port)
+				ok, _ := ruleStore.Check(p.Name(), &candidate)
+				return ok
+			}
+			if port, ok := policy.Pick(known, allowed); ok {
+				endp.Port = strconv.Itoa(port)
+				log.Printf("🔀 Using random port %s for %s\n", endp.Port, endp.IP)
+				tr.draw(traceDraw{
+					Provider: p.Name(),
+					Kind:     "port",
+					Endpoint: traceEndpoint(endp),
+					Note:     fmt.Sprintf("port %s replaced by %s", e.Port, endp.Port),
+				})
+			}
+			res = append(res, endp)
+		}
+		return res
 	}
 }
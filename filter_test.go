@@ -0,0 +1,54 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/ainghazal/torii/rules"
+	"github.com/ainghazal/torii/share"
+	"github.com/ainghazal/torii/vpn"
+)
+
+func Test_withRandomPorts_rules(t *testing.T) {
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "test.db"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	saved := ruleStore
+	defer func() { ruleStore = saved }()
+	if ruleStore, err = rules.NewStore(db, defaultRules); err != nil {
+		t.Fatal(err)
+	}
+
+	p := vpn.NewCustomProvider("riseup")
+	p.AddEndpoint(&vpn.Endpoint{IP: "192.0.2.1", Port: "443", Proto: "openvpn", Transport: "tcp"})
+	ref := vpn.NewCustomProvider("riseup")
+	ref.AddEndpoint(&vpn.Endpoint{IP: "192.0.2.2", Port: "53"})
+	ref.AddEndpoint(&vpn.Endpoint{IP: "192.0.2.3", Port: "1194"})
+
+	tests := []struct {
+		name   string
+		policy *share.PortPolicy
+		want   map[string]bool
+	}{
+		{"range", &share.PortPolicy{Min: 53, Max: 54}, map[string]bool{"54": true}},
+		{"set", &share.PortPolicy{Ports: []int{53, 80}}, map[string]bool{"80": true}},
+		{"known ports", &share.PortPolicy{}, map[string]bool{"1194": true}},
+		{"only denied ports", &share.PortPolicy{Ports: []int{53}}, map[string]bool{"443": true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selector := withRandomPorts(randomEndpointPicker(), tt.policy, ref)
+			for i := 0; i < 50; i++ {
+				for _, e := range selector(p, nil) {
+					if !tt.want[e.Port] {
+						t.Fatalf("got port %s, want one of %v", e.Port, tt.want)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/ainghazal/torii/archive"
+)
+
+const (
+	paramFormat = "format"
+	paramExt    = "ext"
+
+	defaultFormat = "json"
+)
+
+// outputFormat is a way of writing a rendered descriptor. Clients choose one
+// with ?format=name, the extension of the route (e.g. .yaml) or the Accept
+// header, in that order. New formats are added with registerFormat.
+type outputFormat struct {
+	Name        string   `json:"name"`
+	ContentType string   `json:"content_type"`
+	Extensions  []string `json:"extensions,omitempty"`
+	// Attachment is true for formats that are served as a file to save.
+	// Formats that name their own files leave it unset.
+	Attachment bool `json:"-"`
+	// InlineSecrets is true for formats that are useless without the
+	// provider secrets, and so cannot be served secret-free.
+	InlineSecrets bool `json:"inline_secrets,omitempty"`
+	// Descriptor is true for formats that encode the descriptor itself, in
+	// any JSON-shaped syntax. The descriptor is checked against the schema
+	// before writing them (see schema.go).
+	Descriptor bool `json:"-"`
+
+	render func(http.ResponseWriter, *http.Request, *config) error
+}
+
+var (
+	formats = make(map[string]*outputFormat)
+	// formatOrder keeps the registration order, which is the order of
+	// preference when several formats share a content type.
+	formatOrder = []string{}
+)
+
+// registerFormat adds a format to the registry.
+func registerFormat(f *outputFormat) {
+	if _, ok := formats[f.Name]; ok {
+		log.Fatalf("format %s registered twice", f.Name)
+	}
+	formats[f.Name] = f
+	formatOrder = append(formatOrder, f.Name)
+}
+
+// errUnknownFormat is returned for a format that is not registered. An
+// unknown extension means a route that does not exist.
+type errUnknownFormat struct {
+	format string
+	ext    bool
+}
+
+func (e errUnknownFormat) Error() string {
+	return fmt.Sprintf("unknown format: %q", e.format)
+}
+
+func (e errUnknownFormat) status() int {
+	if e.ext {
+		return http.StatusNotFound
+	}
+	return http.StatusBadRequest
+}
+
+// formatFor returns the output format requested by the client.
+func formatFor(r *http.Request) (*outputFormat, error) {
+	if name := r.URL.Query().Get(paramFormat); name != "" {
+		f, ok := formats[name]
+		if !ok {
+			return nil, errUnknownFormat{format: name}
+		}
+		return f, nil
+	}
+	if ext := getParam(paramExt, r); ext != "" {
+		for _, name := range formatOrder {
+			for _, e := range formats[name].Extensions {
+				if e == ext {
+					return formats[name], nil
+				}
+			}
+		}
+		return nil, errUnknownFormat{format: ext, ext: true}
+	}
+	return negotiateFormat(r.Header.Get("Accept")), nil
+}
+
+// negotiateFormat returns the preferred format in an Accept header, or the
+// default format if none of the accepted media types is known.
+func negotiateFormat(accept string) *outputFormat {
+	type mediaRange struct {
+		mediaType string
+		q         float64
+	}
+	ranges := []mediaRange{}
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		ranges = append(ranges, mediaRange{mediaType, q})
+	}
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].q > ranges[j].q
+	})
+	for _, mr := range ranges {
+		if mr.q <= 0 || mr.mediaType == "*/*" {
+			break
+		}
+		for _, name := range formatOrder {
+			if formats[name].ContentType == mr.mediaType {
+				return formats[name]
+			}
+		}
+	}
+	return formats[defaultFormat]
+}
+
+// write writes the rendered config, or the error that prevented rendering
+// it. Errors and explanations are always written as JSON. Descriptors are
+// validated before anything is written or archived. Rendered configs are
+// signed, if there's a signing key (see signing.go), and archived under
+// the hash of their JSON encoding (see archived.go). The ETag is the hash of
+// the body written, which differs between formats. Only the endpoints of
+// descriptors that are actually served count for coverage (see served.go).
+func (f *outputFormat) write(w http.ResponseWriter, r *http.Request, cfg *config, err error, tr *selectionTrace) {
+	if tr != nil || err != nil {
+		writeJSONConfig(w, r, cfg, err, tr)
+		return
+	}
+	if f.Descriptor {
+		body, err := encodeConfig(cfg)
+		if err == nil {
+			err = validateDescriptor(body)
+		}
+		if err != nil {
+			log.Println("ERROR:", err)
+			http.Error(w, errorString(err), http.StatusInternalServerError)
+			return
+		}
+	}
+	// buffer the body, so that it can be hashed and signed
+	buf := &bufferedResponse{w: w}
+	defer buf.flush()
+	w = buf
+
+	w.Header().Set("Content-Type", f.ContentType)
+	w.Header().Add("Vary", "Accept")
+	if f.Attachment {
+		ext := f.Name
+		if len(f.Extensions) != 0 {
+			ext = f.Extensions[0]
+		}
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", cfg.Name+"."+ext))
+	}
+	if err := f.render(w, r, cfg); err != nil {
+		log.Println("ERROR:", err)
+		buf.body.Reset()
+		w.Header().Del("Content-Disposition")
+		w.Header().Del("Content-Type")
+		http.Error(w, errorString(err), http.StatusInternalServerError)
+		return
+	}
+	if buf.status != 0 && buf.status != http.StatusOK {
+		return
+	}
+
+	hash, err := archiveConfig(cfg)
+	if err != nil {
+		log.Println("ERROR: cannot archive descriptor:", err)
+	}
+	if hash != "" {
+		w.Header().Set(headerDescriptor, hash)
+	}
+	etag := `"` + archive.Hash(buf.body.Bytes()) + `"`
+	w.Header().Set("ETag", etag)
+	if etagMatches(r, etag) {
+		buf.body.Reset()
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	recordServed(cfg.selected)
+}
+
+// checkCredentials returns an error if secret-free descriptors are asked
+// for, but the format needs the secrets inline.
+func (f *outputFormat) checkCredentials(tokens bool) error {
+	if tokens && f.InlineSecrets {
+		return fmt.Errorf("format %s cannot be served with %s=%s", f.Name, paramCredentials, credentialsToken)
+	}
+	return nil
+}
+
+// writeFormatError writes the error returned by formatFor.
+func writeFormatError(w http.ResponseWriter, err error) {
+	status := http.StatusBadRequest
+	if e, ok := err.(errUnknownFormat); ok {
+		status = e.status()
+	}
+	http.Error(w, err.Error(), status)
+}
+
+// listFormatsHandler returns the registered formats.
+func listFormatsHandler(w http.ResponseWriter, r *http.Request) {
+	res := []*outputFormat{}
+	for _, name := range formatOrder {
+		res = append(res, formats[name])
+	}
+	json.NewEncoder(w).Encode(res)
+}
+
+func init() {
+	registerFormat(&outputFormat{
+		Name:        "json",
+		ContentType: "application/json",
+		Extensions:  []string{"json"},
+		Descriptor:  true,
+		render: func(w http.ResponseWriter, r *http.Request, cfg *config) error {
+			body, err := encodeConfig(cfg)
+			if err != nil {
+				return err
+			}
+			_, err = w.Write(body)
+			return err
+		},
+	})
+	registerFormat(&outputFormat{
+		Name:        "json-pretty",
+		ContentType: "application/json",
+		Descriptor:  true,
+		render: func(w http.ResponseWriter, r *http.Request, cfg *config) error {
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "  ")
+			return enc.Encode(cfg)
+		},
+	})
+	registerFormat(&outputFormat{
+		Name:        "yaml",
+		ContentType: "application/yaml",
+		Extensions:  []string{"yaml", "yml"},
+		Attachment:  true,
+		Descriptor:  true,
+		render: func(w http.ResponseWriter, r *http.Request, cfg *config) error {
+			// go through json, so that the keys are the same in both
+			obj, err := toObject(cfg)
+			if err != nil {
+				return err
+			}
+			return yaml.NewEncoder(w).Encode(obj)
+		},
+	})
+	registerFormat(&outputFormat{
+		Name:        "csv",
+		ContentType: "text/csv",
+		Extensions:  []string{"csv"},
+		Attachment:  true,
+		render:      writeEndpointsCSV,
+	})
+	registerFormat(&outputFormat{
+		Name:          "ovpn",
+		ContentType:   contentTypeOpenVPN,
+		Extensions:    []string{"ovpn"},
+		InlineSecrets: true,
+		render:        writeOpenVPNProfiles,
+	})
+	registerFormat(&outputFormat{
+		Name:          "wg",
+		ContentType:   contentTypeWireGuard,
+		Extensions:    []string{"conf"},
+		InlineSecrets: true,
+		render:        writeWireGuardConfigs,
+	})
+	registerFormat(&outputFormat{
+		Name:        formatOONIRunV2,
+		ContentType: "application/json",
+		Descriptor:  true,
+		render:      writeOONIRunDescriptor,
+	})
+}
+
+// writeEndpointsCSV writes one line for each endpoint behind the descriptor.
+func writeEndpointsCSV(w http.ResponseWriter, r *http.Request, cfg *config) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{
+		"provider", "label", "ip", "port", "proto", "transport", "obfuscation",
+		"country_code", "geo_country_code", "asn", "pair_id",
+	})
+	for _, sel := range cfg.selected {
+		e := sel.endpoint
+		asn := ""
+		if e.ASN != 0 {
+			asn = strconv.FormatUint(uint64(e.ASN), 10)
+		}
+		cw.Write([]string{
+			sel.provider.Name(), e.Label, e.IP, e.Port, e.Proto, e.Transport, e.Obfuscation,
+			e.CountryCode, e.GeoCountryCode, asn, e.PairID,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
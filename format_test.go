@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ainghazal/torii/archive"
+	"github.com/ainghazal/torii/vpn"
+)
+
+func TestNegotiateFormat(t *testing.T) {
+	tests := []struct {
+		name   string
+		accept string
+		want   string
+	}{
+		{"empty", "", "json"},
+		{"browser", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", "json"},
+		{"yaml", "application/yaml", "yaml"},
+		{"json before pretty", "application/json", "json"},
+		{"by quality", "text/csv;q=0.5, application/yaml", "yaml"},
+		{"wildcard first", "*/*, text/csv;q=0.9", "json"},
+		{"refused", "text/csv;q=0", "json"},
+		{"openvpn", "application/x-openvpn-profile", "ovpn"},
+		{"garbage", ";;;", "json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := negotiateFormat(tt.accept); got.Name != tt.want {
+				t.Errorf("negotiateFormat() = %v, want %v", got.Name, tt.want)
+			}
+		})
+	}
+}
+
+func TestOutputFormat_write_etag(t *testing.T) {
+	riseup := vpn.NewCustomProvider("riseup")
+	endpoint := &vpn.Endpoint{IP: "1.1.1.1", Port: "1194", Proto: "openvpn", Transport: "tcp", Obfuscation: "none"}
+	pick := func(vpn.Provider, *selectionTrace) []*vpn.Endpoint { return []*vpn.Endpoint{endpoint} }
+	cfg, err := renderConfigForProvider(riseup, pick, newDescriptorMeta("riseup", "", ""), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	get := func(format, ifNoneMatch string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if ifNoneMatch != "" {
+			r.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		formats[format].write(w, r, cfg, nil, nil)
+		return w
+	}
+
+	etags := map[string]bool{}
+	for _, format := range []string{"json", "yaml", "csv"} {
+		w := get(format, "")
+		etag := w.Header().Get("ETag")
+		if want := `"` + archive.Hash(w.Body.Bytes()) + `"`; etag != want {
+			t.Errorf("%s: ETag = %s, want the hash of the body %s", format, etag, want)
+		}
+		etags[etag] = true
+
+		if w := get(format, etag); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+			t.Errorf("%s: If-None-Match with the ETag returned %d", format, w.Code)
+		}
+		if w := get(format, "*"); w.Code != http.StatusOK {
+			t.Errorf("%s: If-None-Match: * returned %d", format, w.Code)
+		}
+	}
+	if len(etags) != 3 {
+		t.Errorf("formats share an ETag: %v", etags)
+	}
+}
+
+func TestOutputFormat_write_validates(t *testing.T) {
+	t.Setenv("DEBUG", "1")
+	riseup := vpn.NewCustomProvider("riseup")
+	endpoint := &vpn.Endpoint{IP: "1.1.1.1", Port: "1194", Proto: "openvpn", Transport: "tcp", Obfuscation: "none"}
+	pick := func(vpn.Provider, *selectionTrace) []*vpn.Endpoint { return []*vpn.Endpoint{endpoint} }
+	cfg, err := renderConfigForProvider(riseup, pick, newDescriptorMeta("riseup", "", ""), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.NetTests = nil
+
+	tests := []struct {
+		format string
+		want   int
+	}{
+		{"json", http.StatusInternalServerError},
+		{"json-pretty", http.StatusInternalServerError},
+		{"yaml", http.StatusInternalServerError},
+		{formatOONIRunV2, http.StatusInternalServerError},
+		{"csv", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			formats[tt.format].write(w, httptest.NewRequest(http.MethodGet, "/", nil), cfg, nil, nil)
+			if w.Code != tt.want {
+				t.Errorf("write() status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestOutputFormat_write_renderError(t *testing.T) {
+	f := &outputFormat{
+		Name:        "broken",
+		ContentType: "application/x-broken",
+		Attachment:  true,
+		render: func(w http.ResponseWriter, r *http.Request, cfg *config) error {
+			w.Write([]byte("partial"))
+			return errors.New("cannot render")
+		},
+	}
+	w := httptest.NewRecorder()
+	f.write(w, httptest.NewRequest(http.MethodGet, "/", nil), &config{Name: "test"}, nil, nil)
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("write() status = %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+	if got := w.Header().Get("Content-Disposition"); got != "" {
+		t.Errorf("write() kept Content-Disposition: %s", got)
+	}
+	if got := w.Header().Get("Content-Type"); got == f.ContentType {
+		t.Errorf("write() kept the Content-Type of the format")
+	}
+	if strings.Contains(w.Body.String(), "partial") {
+		t.Errorf("write() kept the partial body: %q", w.Body.String())
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ainghazal/torii/geoip"
+	"github.com/ainghazal/torii/vpn"
+	"github.com/spf13/viper"
+)
+
+// geoDB is the local GeoIP database. It is nil if none is configured.
+var geoDB *geoip.DB
+
+// geoMismatch is an endpoint whose claimed country code does not agree
+// with the GeoIP database.
+type geoMismatch struct {
+	Provider string `json:"provider"`
+	Label    string `json:"label"`
+	IP       string `json:"ip"`
+	Claimed  string `json:"claimed_cc"`
+	Found    string `json:"geoip_cc"`
+	ASN      uint   `json:"asn"`
+}
+
+var geoMismatches = struct {
+	sync.Mutex
+	m map[string]geoMismatch
+}{m: make(map[string]geoMismatch)}
+
+// initGeoIP opens the databases configured with the geoip_country_db and
+// geoip_asn_db keys. GeoIP verification is disabled if none is set.
+func initGeoIP() {
+	countryPath := viper.GetString("geoip_country_db")
+	asnPath := viper.GetString("geoip_asn_db")
+	if countryPath == "" && asnPath == "" {
+		return
+	}
+	db, err := geoip.Open(countryPath, asnPath)
+	if err != nil {
+		log.Println("ERROR: cannot open geoip database:", err)
+		return
+	}
+	geoDB = db
+}
+
+// geoLocateAll annotates the endpoints of all the providers.
+func geoLocateAll() {
+	if geoDB == nil {
+		return
+	}
+	for name, provider := range vpn.Providers {
+		for _, e := range provider.Endpoints() {
+			geoLocate(name, e)
+		}
+	}
+	geoMismatches.Lock()
+	n := len(geoMismatches.m)
+	geoMismatches.Unlock()
+	log.Printf("🌍 Found %d endpoints with a country mismatch\n", n)
+}
+
+// geoAnnotate fills in the GeoIP fields of the endpoint. It returns false if
+// the endpoint could not be looked up. Hostnames (e.g. the remotes of
+// experiments) are valid, but are not looked up.
+func geoAnnotate(e *vpn.Endpoint) (geoip.Record, bool) {
+	if geoDB == nil || net.ParseIP(e.IP) == nil {
+		return geoip.Record{}, false
+	}
+	rec, err := geoDB.Lookup(e.IP)
+	if err != nil {
+		log.Println("ERROR:", err)
+		return geoip.Record{}, false
+	}
+	e.GeoCountryCode = rec.CountryCode
+	e.ASN = rec.ASN
+	return rec, true
+}
+
+// geoLocate fills in the GeoIP fields of an endpoint in the pool of a
+// provider, and flags it if the country code it claims differs from the one
+// in the database. Ad-hoc endpoints, like the remotes of experiments, only
+// need geoAnnotate: they are not the provider's to flag.
+func geoLocate(provider string, e *vpn.Endpoint) {
+	rec, ok := geoAnnotate(e)
+	if !ok {
+		return
+	}
+
+	key := endpointKey(provider, e)
+	geoMismatches.Lock()
+	defer geoMismatches.Unlock()
+	if rec.CountryCode == "" || rec.CountryCode == e.CountryCode {
+		delete(geoMismatches.m, key)
+		return
+	}
+	geoMismatches.m[key] = geoMismatch{
+		Provider: provider,
+		Label:    e.Label,
+		IP:       e.IP,
+		Claimed:  e.CountryCode,
+		Found:    rec.CountryCode,
+		ASN:      rec.ASN,
+	}
+}
+
+// geoStatusHandler returns the list of endpoints with a country mismatch.
+func geoStatusHandler(w http.ResponseWriter, r *http.Request) {
+	if geoDB == nil {
+		http.Error(w, errNotFoundStr, http.StatusNotFound)
+		return
+	}
+	geoMismatches.Lock()
+	mismatches := []geoMismatch{}
+	for _, m := range geoMismatches.m {
+		mismatches = append(mismatches, m)
+	}
+	geoMismatches.Unlock()
+	json.NewEncoder(w).Encode(mismatches)
+}
+
+// byASNFilter returns a filter that matches endpoints in the passed
+// autonomous system, given either as "AS1234" or "1234". An empty asn
+// matches all the endpoints.
+func byASNFilter(asn string) namedFilter {
+	nf := namedFilter{name: "asn", match: nullFilter}
+	if asn == "" {
+		return nf
+	}
+	n, err := strconv.ParseUint(strings.TrimPrefix(strings.ToUpper(asn), "AS"), 10, 32)
+	if err != nil {
+		// an unparseable asn matches nothing
+		nf.match = func(*vpn.Endpoint) bool { return false }
+		nf.reason = func(*vpn.Endpoint) string { return "bad asn " + asn }
+		return nf
+	}
+	nf.match = func(e *vpn.Endpoint) bool {
+		return e.ASN == uint(n)
+	}
+	nf.reason = func(e *vpn.Endpoint) string {
+		return fmt.Sprintf("AS%d != AS%d", e.ASN, n)
+	}
+	return nf
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ainghazal/torii/geoip"
+	"github.com/ainghazal/torii/vpn"
+)
+
+func Test_geoAnnotate(t *testing.T) {
+	db, err := geoip.Open(filepath.Join("testdata", "geoip-country.mmdb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	saved := geoDB
+	defer func() { geoDB = saved }()
+	geoDB = db
+
+	logs := &bytes.Buffer{}
+	log.SetOutput(logs)
+	defer log.SetOutput(os.Stderr)
+
+	tests := []struct {
+		name   string
+		ip     string
+		wantOK bool
+		wantCC string
+	}{
+		{"ip in the database", "192.0.2.1", true, "nl"},
+		{"ip not in the database", "198.51.100.1", true, ""},
+		{"hostname", "vpn.example.org", false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &vpn.Endpoint{IP: tt.ip}
+			if _, ok := geoAnnotate(e); ok != tt.wantOK || e.GeoCountryCode != tt.wantCC {
+				t.Errorf("geoAnnotate() = %v, %q, want %v, %q", ok, e.GeoCountryCode, tt.wantOK, tt.wantCC)
+			}
+		})
+	}
+	if logs.Len() != 0 {
+		t.Errorf("geoAnnotate() logged: %s", logs.String())
+	}
+}
@@ -0,0 +1,94 @@
+// Package geoip looks up the country and the autonomous system of IP
+// addresses in local MaxMind-format databases (GeoLite2-Country,
+// GeoLite2-ASN, or a combined database with both sets of fields).
+package geoip
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+var (
+	errNoDatabase = errors.New("no geoip database")
+	errBadIP      = errors.New("cannot parse ip")
+)
+
+// Record is the result of a lookup. Empty fields mean that the database had
+// no information about the address.
+type Record struct {
+	CountryCode string `json:"cc"`
+	ASN         uint   `json:"asn"`
+	ASOrg       string `json:"as_org"`
+}
+
+// record matches the layout of the MaxMind databases.
+type record struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	ASN   uint   `maxminddb:"autonomous_system_number"`
+	ASOrg string `maxminddb:"autonomous_system_organization"`
+}
+
+// DB wraps the country and ASN databases. Any of them can be missing.
+type DB struct {
+	readers []*maxminddb.Reader
+}
+
+// Open opens the databases at the passed paths. Empty paths are skipped, and
+// the same path can be passed twice for a combined database.
+func Open(paths ...string) (*DB, error) {
+	db := &DB{}
+	seen := make(map[string]bool)
+	for _, p := range paths {
+		if p == "" || seen[p] {
+			continue
+		}
+		seen[p] = true
+		r, err := maxminddb.Open(p)
+		if err != nil {
+			db.Close()
+			return nil, fmt.Errorf("open %s: %w", p, err)
+		}
+		db.readers = append(db.readers, r)
+	}
+	if len(db.readers) == 0 {
+		return nil, errNoDatabase
+	}
+	return db, nil
+}
+
+// Lookup returns the merged information from all the databases for the
+// passed address.
+func (db *DB) Lookup(addr string) (Record, error) {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return Record{}, fmt.Errorf("%w: %s", errBadIP, addr)
+	}
+	res := Record{}
+	for _, r := range db.readers {
+		rec := record{}
+		if err := r.Lookup(ip, &rec); err != nil {
+			return Record{}, err
+		}
+		if rec.Country.ISOCode != "" {
+			res.CountryCode = strings.ToLower(rec.Country.ISOCode)
+		}
+		if rec.ASN != 0 {
+			res.ASN = rec.ASN
+			res.ASOrg = rec.ASOrg
+		}
+	}
+	return res, nil
+}
+
+// Close closes all the databases.
+func (db *DB) Close() {
+	for _, r := range db.readers {
+		r.Close()
+	}
+}
@@ -0,0 +1,186 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// writeTestDB writes a MaxMind-format IPv4 database with the passed networks,
+// and returns its path. The values are maps of strings or uints, which is
+// enough for the fields we read.
+func writeTestDB(t *testing.T, networks map[string]map[string]any) string {
+	type node struct{ child [2]*node }
+	root := &node{}
+	data := &bytes.Buffer{}
+	// leaves maps the last node of a network to the offset of its value in
+	// the data section, plus one
+	leaves := map[*node]int{}
+
+	cidrs := []string{}
+	for cidr := range networks {
+		cidrs = append(cidrs, cidr)
+	}
+	sort.Strings(cidrs)
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ones, _ := network.Mask.Size()
+		offset := data.Len()
+		encodeValue(data, networks[cidr])
+		n := root
+		for i := 0; i < ones; i++ {
+			bit := network.IP.To4()[i/8] >> (7 - i%8) & 1
+			if n.child[bit] == nil {
+				n.child[bit] = &node{}
+			}
+			n = n.child[bit]
+		}
+		leaves[n] = offset + 1
+	}
+
+	// number the inner nodes breadth first, the root is node 0
+	order := []*node{root}
+	for i := 0; i < len(order); i++ {
+		for _, c := range order[i].child {
+			if c != nil && leaves[c] == 0 {
+				order = append(order, c)
+			}
+		}
+	}
+	ids := map[*node]int{}
+	for i, n := range order {
+		ids[n] = i
+	}
+	count := len(order)
+	tree := &bytes.Buffer{}
+	for _, n := range order {
+		for _, c := range n.child {
+			record := count // empty
+			if c != nil && leaves[c] != 0 {
+				record = count + 16 + leaves[c] - 1
+			} else if c != nil {
+				record = ids[c]
+			}
+			tree.Write([]byte{byte(record >> 16), byte(record >> 8), byte(record)})
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	buf.Write(tree.Bytes())
+	buf.Write(make([]byte, 16))
+	buf.Write(data.Bytes())
+	buf.WriteString("\xab\xcd\xefMaxMind.com")
+	encodeValue(buf, map[string]any{
+		"binary_format_major_version": uint(2),
+		"binary_format_minor_version": uint(0),
+		"build_epoch":                 uint(0),
+		"database_type":               "Test",
+		"description":                 map[string]any{"en": "test"},
+		"ip_version":                  uint(4),
+		"languages":                   []string{"en"},
+		"node_count":                  uint(count),
+		"record_size":                 uint(24),
+	})
+	path := filepath.Join(t.TempDir(), "test.mmdb")
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// encodeValue writes v in the MaxMind DB data format. Only strings shorter
+// than 285 bytes, uints, small maps and string arrays are supported.
+func encodeValue(w *bytes.Buffer, v any) {
+	switch v := v.(type) {
+	case string:
+		if len(v) < 29 {
+			w.WriteByte(2<<5 | byte(len(v)))
+		} else {
+			w.Write([]byte{2<<5 | 29, byte(len(v) - 29)})
+		}
+		w.WriteString(v)
+	case uint:
+		b := make([]byte, 8)
+		binary.BigEndian.PutUint64(b, uint64(v))
+		b = bytes.TrimLeft(b, "\x00")
+		// uint64 is an extended type
+		w.WriteByte(byte(len(b)))
+		w.WriteByte(9 - 7)
+		w.Write(b)
+	case []string:
+		w.WriteByte(byte(len(v)))
+		w.WriteByte(11 - 7)
+		for _, s := range v {
+			encodeValue(w, s)
+		}
+	case map[string]any:
+		keys := []string{}
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		w.WriteByte(7<<5 | byte(len(v)))
+		for _, k := range keys {
+			encodeValue(w, k)
+			encodeValue(w, v[k])
+		}
+	default:
+		panic("cannot encode value")
+	}
+}
+
+func TestDB_Lookup(t *testing.T) {
+	country := writeTestDB(t, map[string]map[string]any{
+		"192.0.2.0/24":    {"country": map[string]any{"iso_code": "NL"}},
+		"198.51.100.0/25": {"country": map[string]any{"iso_code": "CA"}},
+	})
+	asn := writeTestDB(t, map[string]map[string]any{
+		"192.0.2.0/23": {"autonomous_system_number": uint(64496), "autonomous_system_organization": "Example"},
+	})
+	db, err := Open(country, asn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	tests := []struct {
+		name    string
+		addr    string
+		want    Record
+		wantErr error
+	}{
+		{"both databases", "192.0.2.10", Record{CountryCode: "nl", ASN: 64496, ASOrg: "Example"}, nil},
+		{"country only", "198.51.100.1", Record{CountryCode: "ca"}, nil},
+		{"asn only", "192.0.3.1", Record{ASN: 64496, ASOrg: "Example"}, nil},
+		{"not found", "203.0.113.1", Record{}, nil},
+		{"bad address", "not-an-ip", Record{}, errBadIP},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := db.Lookup(tt.addr)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Lookup() err = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Lookup() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOpen(t *testing.T) {
+	if _, err := Open("", ""); !errors.Is(err, errNoDatabase) {
+		t.Errorf("Open() without paths, err = %v", err)
+	}
+	if _, err := Open(filepath.Join(t.TempDir(), "missing.mmdb")); err == nil {
+		t.Errorf("Open() of a missing file should fail")
+	}
+}
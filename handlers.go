@@ -1,11 +1,12 @@
 package main
 
 import (
-	"encoding/json"
+	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"strconv"
-	"strings"
+	"time"
 
 	"github.com/ainghazal/torii/share"
 	"github.com/ainghazal/torii/vpn"
@@ -15,37 +16,95 @@ import (
 
 type httpHandler func(http.ResponseWriter, *http.Request)
 
-func randomEndpointDescriptor(w http.ResponseWriter, r *http.Request) {
-	providerName := getParam(paramProvider, r)
-	if !vpn.IsKnownProvider(providerName) {
-		http.Error(w, errNotFoundStr, http.StatusNotFound)
+// strategyDescriptorHandler returns a handler that renders a descriptor for
+// the provider in the path, with the strategy given by ?strategy=, or
+// defaultName if none is given. The strategy parameters come from the path
+// and the query string. The result is written in the format requested by
+// the client (see formatFor).
+func strategyDescriptorHandler(defaultName string) httpHandler {
+	return func(w http.ResponseWriter, r *http.Request) {
+		providerName := getParam(paramProvider, r)
+		if !vpn.IsKnownProvider(providerName) {
+			http.Error(w, errNotFoundStr, http.StatusNotFound)
+			return
+		}
+		format, err := formatFor(r)
+		if err != nil {
+			writeFormatError(w, err)
+			return
+		}
+		tokens := wantsCredentialTokens(r, nil)
+		if err := format.checkCredentials(tokens); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		name := r.URL.Query().Get(paramStrategy)
+		if name == "" {
+			name = defaultName
+		}
+		params := strategyParamsFromRequest(r)
+		selector, err := selectorForStrategy(name, params)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		p := vpn.Providers[providerName]
+		tr := traceFor(r)
+		meta := newDescriptorMeta(providerName, params.CountryCode, name)
+		cfg, err := renderConfigForProvider(p, selector, meta, tr)
+		if err == nil && tokens {
+			err = withoutSecrets(cfg, credentialsURL())
+		}
+		format.write(w, r, cfg, err, tr)
+	}
+}
+
+// mixedEndpointDescriptor returns a single descriptor with endpoints drawn
+// from several providers, as given by the providers query parameter (e.g.
+// "riseup:2,tunnelbear:1"). The quota of each provider is passed as max to
+// the strategy given by ?strategy=.
+func mixedEndpointDescriptor(w http.ResponseWriter, r *http.Request) {
+	format, err := formatFor(r)
+	if err != nil {
+		writeFormatError(w, err)
 		return
 	}
-	p := vpn.Providers[providerName]
-	cfg, err := renderConfigForProvider(p, randomEndpointPicker())
+	tokens := wantsCredentialTokens(r, nil)
+	if err := format.checkCredentials(tokens); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	quotas, err := parseProviderQuotas(r.URL.Query().Get(paramProviders))
 	if err != nil {
-		http.Error(w, errorString(err), http.StatusGatewayTimeout)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	json.NewEncoder(w).Encode(cfg)
-}
-
-func byCountryEndpointDescriptor(w http.ResponseWriter, r *http.Request) {
-	providerName := getParam(paramProvider, r)
-	if !vpn.IsKnownProvider(providerName) {
-		http.Error(w, errNotFoundStr, http.StatusNotFound)
+	name := r.URL.Query().Get(paramStrategy)
+	params := strategyParamsFromRequest(r)
+	if _, err := selectorForStrategy(name, params); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	cc := getParam(paramCountryCode, r)
+	tr := traceFor(r)
+	meta := newDescriptorMeta("", params.CountryCode, name)
+	cfg, err := renderMixedConfig(quotas, mixedSelectorFor(name, params, nil), meta, tr)
+	if err == nil && tokens {
+		err = withoutSecrets(cfg, credentialsURL())
+	}
+	format.write(w, r, cfg, err, tr)
+}
 
-	p := vpn.Providers[providerName]
-	cfg, err := renderConfigForProvider(p, byCountryEndpointPicker(cc, 1))
-	if err != nil {
-		http.Error(w, errorString(err), http.StatusGatewayTimeout)
-		return
+// mixedSelectorFor returns a function that builds the selector for each
+// provider of a mixed descriptor, using the named strategy with the quota of
+// the provider as max. The strategy must have been checked beforehand.
+func mixedSelectorFor(name string, params strategyParams, ports *share.PortPolicy) func(vpn.Provider, int) endpointSelectorFn {
+	return func(p vpn.Provider, count int) endpointSelectorFn {
+		params.Max = count
+		selector, _ := selectorForStrategy(name, params)
+		return withRandomPorts(selector, ports, p)
 	}
-	json.NewEncoder(w).Encode(cfg)
 }
 
 // newCustomProviderFromExperiment returns a "custom" provider from a given
@@ -57,7 +116,7 @@ func byCountryEndpointDescriptor(w http.ResponseWriter, r *http.Request) {
 // we generate a provider "on the fly" and construct a single remote that is
 // assoiated with it. The usage of some of the fields (like cc) is a little
 // handwavy for now, but it serves my purpose well.
-func newCustomProviderFromExperiment(exp *share.Experiment) vpn.Provider {
+func newCustomProviderFromExperiment(exp *share.Experiment) (vpn.Provider, error) {
 	// this assumes we're given a remote in the experiment definition.
 	p := vpn.NewCustomProvider(exp.Provider)
 	p.CustomName = exp.Provider + "-" + exp.Name
@@ -70,11 +129,11 @@ func newCustomProviderFromExperiment(exp *share.Experiment) vpn.Provider {
 		refProvider := vpn.Providers[exp.Provider]
 		p.AuthFromProvider(refProvider)
 	}
-	remoteParts := strings.Split(exp.EndpointRemote, ":")
-
-	// TODO be defensive, validate
-	ip := remoteParts[0]
-	port := remoteParts[1]
+	// experiments are validated when added, but older ones were not
+	ip, port, err := net.SplitHostPort(exp.EndpointRemote)
+	if err != nil {
+		return nil, err
+	}
 
 	customEndpoint := &vpn.Endpoint{
 		Label:       exp.Name,
@@ -85,36 +144,94 @@ func newCustomProviderFromExperiment(exp *share.Experiment) vpn.Provider {
 		Obfuscation: "none",
 		CountryCode: exp.CountryCode, // this could be a wrong one, need to check against the canonical list
 	}
+	geoAnnotate(customEndpoint)
 	p.AddEndpoint(customEndpoint)
-	return p
+	return p, nil
 }
 
+// DescriptorByUUIDHandler returns a handler that renders the descriptor for
+// a shared experiment, in the format requested by the client. Older revisions
+// of the experiment can be rendered with ?rev=N, even after it's deleted.
 func DescriptorByUUIDHandler(db *bolt.DB) httpHandler {
 	return func(w http.ResponseWriter, r *http.Request) {
-		uuid := getParam("uuid", r)
-		exp := share.GetExperimentByUUID(db, uuid)[0]
+		format, err := formatFor(r)
+		if err != nil {
+			writeFormatError(w, err)
+			return
+		}
+		rev, err := share.RevisionParam(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		exp, err := share.GetExperiment(db, getParam("uuid", r), rev)
+		if err != nil {
+			http.Error(w, errNotFoundStr, http.StatusNotFound)
+			return
+		}
+		if exp.Deleted() {
+			writeDeletedExperiment(w, exp)
+			return
+		}
+		tokens := wantsCredentialTokens(r, exp)
+		if err := format.checkCredentials(tokens); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 
 		var cfg *config
-		var err error
 		var p vpn.Provider
+		tr := traceFor(r)
 
-		if exp.EndpointRemote != "" {
-			p = newCustomProviderFromExperiment(exp)
-			cfg, err = renderConfigForProvider(p, randomEndpointPicker())
+		// ref is the provider we take known ports from
+		ref, ok := vpn.Providers[exp.Provider]
+		params := strategyParamsFromExperiment(exp)
+		if exp.Mix != "" {
+			var quotas []providerQuota
+			quotas, err = parseProviderQuotas(exp.Mix)
+			if err == nil {
+				_, err = selectorForStrategy(exp.Strategy, params)
+			}
+			if err == nil {
+				meta := metaFromExperiment(exp, exp.Strategy)
+				// no per-provider templates in a mixed descriptor
+				meta.providerKey = ""
+				cfg, err = renderMixedConfig(quotas, mixedSelectorFor(exp.Strategy, params, exp.PortPolicy), meta, tr)
+			}
+		} else if exp.EndpointRemote != "" {
+			p, err = newCustomProviderFromExperiment(exp)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if !ok {
+				ref = p
+			}
+			selector := withRandomPorts(randomEndpointPicker(), exp.PortPolicy, ref)
+			cfg, err = renderConfigForProvider(p, selector, metaFromExperiment(exp, "remote"), tr)
+		} else if !ok {
+			http.Error(w, errNotFoundStr, http.StatusNotFound)
+			return
 		} else {
-			p := vpn.Providers[exp.Provider]
-			cc := exp.CountryCode
-			max := exp.Max
-			cfg, err = renderConfigForProvider(p, byCountryEndpointPicker(cc, strToIntOrOne(max)))
+			var selector endpointSelectorFn
+			selector, err = selectorForStrategy(exp.Strategy, params)
+			if err == nil {
+				selector = withRandomPorts(selector, exp.PortPolicy, ref)
+				cfg, err = renderConfigForProvider(ref, selector, metaFromExperiment(exp, exp.Strategy), tr)
+			}
 		}
-		if err != nil {
-			http.Error(w, errorString(err), http.StatusGatewayTimeout)
-			return
+		if err == nil && tokens {
+			err = withoutSecrets(cfg, credentialsURL())
 		}
-		json.NewEncoder(w).Encode(cfg)
+		format.write(w, r, cfg, err, tr)
 	}
 }
 
+// writeDeletedExperiment tells that a shared experiment is gone.
+func writeDeletedExperiment(w http.ResponseWriter, exp *share.Experiment) {
+	http.Error(w, fmt.Sprintf(errDeletedStr, exp.DeletedAt.Format(time.RFC3339)), http.StatusGone)
+}
+
 func strToIntOrOne(s string) int {
 	maxInt := 1
 	if s != "" {
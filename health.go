@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	health "github.com/ainghazal/health-check"
+	"github.com/ainghazal/torii/vpn"
+	"github.com/spf13/viper"
+)
+
+const (
+	defaultHealthRefreshInterval = time.Minute
+
+	// policyFailOpen keeps endpoints that errored or were never checked.
+	policyFailOpen = "fail-open"
+	// policyFailClosed drops endpoints that errored or were never checked.
+	policyFailClosed = "fail-closed"
+	// policyExcludeUnchecked drops endpoints that were never checked, but
+	// keeps the ones that errored.
+	policyExcludeUnchecked = "exclude-unchecked"
+)
+
+type healthState int
+
+const (
+	stateUnchecked healthState = iota
+	stateHealthy
+	stateUnhealthy
+	stateErrored
+)
+
+func (s healthState) String() string {
+	return [...]string{"unchecked", "healthy", "unhealthy", "errored"}[s]
+}
+
+// healthSnapshot is the last known state of every endpoint of a provider,
+// kept by a background loop (see startHealthRefresher), so that selection
+// never waits for the health checker.
+type healthSnapshot struct {
+	mu      sync.RWMutex
+	states  map[string]healthState
+	updated time.Time
+}
+
+func (s *healthSnapshot) state(key string) healthState {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.states[key]
+}
+
+var (
+	healthSnapshotsMu sync.RWMutex
+	healthSnapshots   = make(map[string]*healthSnapshot)
+)
+
+func snapshotFor(provider string) *healthSnapshot {
+	healthSnapshotsMu.RLock()
+	defer healthSnapshotsMu.RUnlock()
+	return healthSnapshots[provider]
+}
+
+// startHealthRefresher checks all the endpoints of the provider in the
+// background, every health_refresh_interval.
+func startHealthRefresher(provider vpn.Provider, hs *health.HealthService) {
+	healthSnapshotsMu.Lock()
+	healthSnapshots[provider.Name()] = &healthSnapshot{states: make(map[string]healthState)}
+	healthSnapshotsMu.Unlock()
+
+	interval := viper.GetDuration("health_refresh_interval")
+	if interval <= 0 {
+		interval = defaultHealthRefreshInterval
+	}
+	go func() {
+		for {
+			refreshHealth(provider, hs)
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// refreshHealth checks every endpoint of the provider, records the results in
+// the check history, and swaps the snapshot for the provider.
+func refreshHealth(provider vpn.Provider, hs *health.HealthService) {
+	states := make(map[string]healthState)
+	for _, endp := range provider.Endpoints() {
+		key := endpointKey(provider.Name(), endp)
+		addr, err := endpointTCPAddr(endp)
+		if err != nil {
+			states[key] = stateErrored
+			continue
+		}
+		// the latency is the time it takes the checker to answer,
+		// which includes the handshake when it probes on demand.
+		start := time.Now()
+		healthy, err := hs.Healthy(addr, endp.Transport)
+		if err != nil {
+			states[key] = stateErrored
+			continue
+		}
+		endpointHistory.record(key, checkRecord{
+			OK:      healthy,
+			Latency: time.Since(start),
+			At:      start,
+		})
+		if healthy {
+			states[key] = stateHealthy
+		} else {
+			states[key] = stateUnhealthy
+		}
+	}
+	snap := snapshotFor(provider.Name())
+	snap.mu.Lock()
+	snap.states = states
+	snap.updated = time.Now()
+	snap.mu.Unlock()
+	log.Printf("🩺 Refreshed health snapshot for %s (%d endpoints)\n", provider.Name(), len(states))
+}
+
+// healthPolicy returns the policy configured for the provider with the
+// health_policy.<provider> key. It defaults to fail-open.
+func healthPolicy(provider string) string {
+	switch p := viper.GetString("health_policy." + provider); p {
+	case policyFailClosed, policyExcludeUnchecked:
+		return p
+	case "", policyFailOpen:
+	default:
+		log.Printf("WARN: unknown health policy %q for %s\n", p, provider)
+	}
+	return policyFailOpen
+}
+
+// healthPolicyFilter returns a filter that applies the health policy of the
+// provider to the errored and unchecked endpoints in its snapshot. Unhealthy
+// endpoints are never filtered out: they are only weighted down. Custom
+// providers, and providers without health checks, are not filtered.
+func healthPolicyFilter(p vpn.Provider) namedFilter {
+	nf := namedFilter{name: "health", match: nullFilter}
+	if _, ok := p.(*vpn.CustomProvider); ok {
+		return nf
+	}
+	snap := snapshotFor(p.Name())
+	if snap == nil {
+		return nf
+	}
+	policy := healthPolicy(p.Name())
+	nf.match = func(e *vpn.Endpoint) bool {
+		switch snap.state(endpointKey(p.Name(), e)) {
+		case stateErrored:
+			return policy != policyFailClosed
+		case stateUnchecked:
+			return policy == policyFailOpen
+		}
+		return true
+	}
+	nf.reason = func(e *vpn.Endpoint) string {
+		return fmt.Sprintf("%s (%s)", snap.state(endpointKey(p.Name(), e)), policy)
+	}
+	return nf
+}
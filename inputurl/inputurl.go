@@ -0,0 +1,110 @@
+// Package inputurl builds and parses the vpn:// input URLs of the vpn
+// nettests, e.g. "vpn://openvpn.riseup/?addr=1.1.1.1:1194&transport=tcp".
+package inputurl
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+const (
+	scheme = "vpn"
+
+	paramAddr        = "addr"
+	paramTransport   = "transport"
+	paramObfuscation = "obfuscation"
+)
+
+var (
+	errBadScheme = errors.New("inputurl: scheme is not vpn")
+	errBadHost   = errors.New("inputurl: host is not <proto>.<provider>")
+	errNoAddr    = errors.New("inputurl: missing addr")
+)
+
+// InputURL is the input of a vpn nettest.
+type InputURL struct {
+	// Proto is the vpn protocol, one of openvpn or wg.
+	Proto    string
+	Provider string
+	// Addr is the IP (v4 or v6) or hostname of the endpoint.
+	Addr      string
+	Port      string
+	Transport string
+	// Obfuscation is empty, or "none", for plain endpoints.
+	Obfuscation string
+	// Params are any other parameters, e.g. for the obfuscation.
+	Params url.Values
+}
+
+// String returns the input URL. The known parameters go first, in a fixed
+// order, followed by the extra ones sorted by key.
+func (u *InputURL) String() string {
+	query := []string{param(paramAddr, net.JoinHostPort(u.Addr, u.Port))}
+	if u.Transport != "" {
+		query = append(query, param(paramTransport, u.Transport))
+	}
+	if u.Obfuscation != "" && u.Obfuscation != "none" {
+		query = append(query, param(paramObfuscation, u.Obfuscation))
+	}
+	keys := make([]string, 0, len(u.Params))
+	for k := range u.Params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range u.Params[k] {
+			query = append(query, param(k, v))
+		}
+	}
+	return scheme + "://" + u.Proto + "." + u.Provider + "/?" + strings.Join(query, "&")
+}
+
+// param escapes a query parameter. Colons are kept as they are, since they
+// are valid in a query and the addresses read better with them.
+func param(k, v string) string {
+	return url.QueryEscape(k) + "=" + strings.ReplaceAll(url.QueryEscape(v), "%3A", ":")
+}
+
+// Parse parses an input URL.
+func Parse(s string) (*InputURL, error) {
+	parsed, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	if parsed.Scheme != scheme {
+		return nil, errBadScheme
+	}
+	proto, provider, ok := strings.Cut(parsed.Host, ".")
+	if !ok || proto == "" || provider == "" {
+		return nil, errBadHost
+	}
+	query, err := url.ParseQuery(parsed.RawQuery)
+	if err != nil {
+		return nil, err
+	}
+	if query.Get(paramAddr) == "" {
+		return nil, errNoAddr
+	}
+	addr, port, err := net.SplitHostPort(query.Get(paramAddr))
+	if err != nil {
+		return nil, err
+	}
+	u := &InputURL{
+		Proto:       proto,
+		Provider:    provider,
+		Addr:        addr,
+		Port:        port,
+		Transport:   query.Get(paramTransport),
+		Obfuscation: query.Get(paramObfuscation),
+	}
+	for _, k := range []string{paramAddr, paramTransport, paramObfuscation} {
+		query.Del(k)
+	}
+	if len(query) != 0 {
+		u.Params = query
+	}
+	return u, nil
+}
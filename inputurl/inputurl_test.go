@@ -0,0 +1,63 @@
+package inputurl
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		in   *InputURL
+		want string
+	}{
+		{
+			name: "ipv4",
+			in:   &InputURL{Proto: "openvpn", Provider: "riseup", Addr: "1.1.1.1", Port: "1194", Transport: "tcp"},
+			want: "vpn://openvpn.riseup/?addr=1.1.1.1:1194&transport=tcp",
+		},
+		{
+			name: "ipv6",
+			in:   &InputURL{Proto: "openvpn", Provider: "riseup", Addr: "2001:db8::1", Port: "443", Transport: "udp"},
+			want: "vpn://openvpn.riseup/?addr=%5B2001:db8::1%5D:443&transport=udp",
+		},
+		{
+			name: "obfuscation with params",
+			in: &InputURL{
+				Proto: "openvpn", Provider: "riseup", Addr: "1.1.1.1", Port: "443", Transport: "tcp",
+				Obfuscation: "obfs4",
+				Params:      url.Values{"iat-mode": {"0"}, "cert": {"a+b/c=="}},
+			},
+			want: "vpn://openvpn.riseup/?addr=1.1.1.1:443&transport=tcp&obfuscation=obfs4&cert=a%2Bb%2Fc%3D%3D&iat-mode=0",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.in.String()
+			if got != tt.want {
+				t.Errorf("String() = %v, want %v", got, tt.want)
+			}
+			parsed, err := Parse(got)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if !reflect.DeepEqual(parsed, tt.in) {
+				t.Errorf("Parse() = %+v, want %+v", parsed, tt.in)
+			}
+		})
+	}
+}
+
+func TestParse_errors(t *testing.T) {
+	for _, s := range []string{
+		"https://openvpn.riseup/?addr=1.1.1.1:1194",
+		"vpn://openvpn/?addr=1.1.1.1:1194",
+		"vpn://openvpn.riseup/?transport=tcp",
+		"vpn://openvpn.riseup/?addr=1.1.1.1",
+	} {
+		if _, err := Parse(s); err == nil {
+			t.Errorf("Parse(%q) did not fail", s)
+		}
+	}
+}
@@ -3,10 +3,15 @@ package main
 import (
 	"log"
 	"net/http"
+	"os"
 
 	"github.com/gorilla/mux"
 
 	health "github.com/ainghazal/health-check"
+	"github.com/ainghazal/torii/archive"
+	"github.com/ainghazal/torii/coverage"
+	"github.com/ainghazal/torii/creds"
+	"github.com/ainghazal/torii/rules"
 	"github.com/ainghazal/torii/share"
 	"github.com/ainghazal/torii/vpn"
 )
@@ -18,13 +23,15 @@ var (
 )
 
 const (
-	authorName = "Ain Ghazal <ain@openobservatory.org>"
-
 	paramProvider    = "provider"
 	paramCountryCode = "cc"
+	paramMax         = "max"
+	paramASN         = "asn"
+	paramProviders   = "providers"
 
 	errNotFoundStr = "not found"
 	errTryAgainStr = "try again later"
+	errDeletedStr  = "this experiment was deleted on %s"
 	errNoConfig    = "cannot build config"
 
 	msgHomeStr = "nothing to see here"
@@ -44,8 +51,18 @@ func hasItem(s []string, str string) bool {
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "verify":
+			os.Exit(runVerify(os.Args[2:]))
+		case "render":
+			os.Exit(runRender(os.Args[2:]))
+		}
+	}
+
 	initRand()
 	loadConfig()
+	initSigner()
 
 	db, err := share.InitDB()
 	if err != nil {
@@ -53,11 +70,30 @@ func main() {
 	}
 	defer db.Close()
 
+	servedStore, err = coverage.NewStore(db)
+	if err != nil {
+		log.Println("ERROR: cannot init coverage store:", err)
+	}
+	descriptorStore, err = archive.NewStore(db)
+	if err != nil {
+		log.Println("ERROR: cannot init descriptor archive:", err)
+	}
+	credStore, err = creds.NewStore(db)
+	if err != nil {
+		log.Println("ERROR: cannot init credentials store:", err)
+	}
+	ruleStore, err = rules.NewStore(db, defaultRules)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	log.Println("🌿 Initializing all providers...")
 	err = vpn.InitAllProviders()
 	if err != nil {
 		log.Fatal(err)
 	}
+	initGeoIP()
+	geoLocateAll()
 	for name, provider := range vpn.Providers {
 		if isEnabledProvider(name) {
 			hs := &health.HealthService{
@@ -68,11 +104,15 @@ func main() {
 			}
 			hs.Start()
 			healthServiceMap[name] = hs
+			startHealthRefresher(provider, hs)
 		}
 	}
 
 	r := mux.NewRouter().StrictSlash(false)
 	r.HandleFunc("/", homeHandler)
+	r.HandleFunc("/.well-known/torii-signing-key", signingKeyHandler)
+	r.HandleFunc("/d/{hash:[0-9a-f]{64}}", archivedDescriptorHandler)
+	r.HandleFunc(descriptorSchemaID, descriptorSchemaHandler)
 	api := r.PathPrefix("/api").Subrouter()
 	shr := r.PathPrefix("/share").Subrouter()
 	vpn := r.PathPrefix("/vpn").Subrouter()
@@ -87,18 +127,36 @@ func main() {
 	})
 
 	// api calls
-	api.HandleFunc("/experiment/add", share.AddExperimentHandler(db))
+	api.HandleFunc("/experiment/add", share.AddExperimentHandler(db, shareURL))
 	api.HandleFunc("/experiment/list", share.ListExperimentHandler(db))
-	api.HandleFunc("/experiment/{uuid}", share.RenderJSONExperimentByUUID(db))
+	api.HandleFunc("/experiment/{uuid}", share.RenderJSONExperimentByUUID(db)).Methods(http.MethodGet)
+	api.HandleFunc("/experiment/{uuid}", requireEditor(db, share.UpdateExperimentHandler(db))).Methods(http.MethodPut, http.MethodPatch)
+	api.HandleFunc("/experiment/{uuid}", requireEditor(db, share.DeleteExperimentHandler(db))).Methods(http.MethodDelete)
+	api.HandleFunc("/experiment/{uuid}/revisions", share.ListRevisionsHandler(db)).Methods(http.MethodGet)
+	api.HandleFunc("/credentials", credentialsHandler).Methods(http.MethodGet)
+	api.HandleFunc("/credentials/tokens", requireAdmin(listCredentialTokensHandler)).Methods(http.MethodGet)
+	api.HandleFunc("/credentials/tokens/{id}", requireAdmin(revokeCredentialTokenHandler)).Methods(http.MethodDelete)
+	api.HandleFunc("/rules", requireAdmin(listRulesHandler)).Methods(http.MethodGet)
+	api.HandleFunc("/rules", requireAdmin(addRuleHandler)).Methods(http.MethodPost)
+	api.HandleFunc("/rules/{id}", requireAdmin(deleteRuleHandler)).Methods(http.MethodDelete)
 
 	// json handlers
-	vpn.HandleFunc("/random/{provider}.json", randomEndpointDescriptor)
-	vpn.HandleFunc("/{cc}/{provider}.json", byCountryEndpointDescriptor)
+	vpn.HandleFunc("/strategies", listStrategiesHandler)
+	vpn.HandleFunc("/formats", listFormatsHandler)
+	vpn.HandleFunc("/mix.{ext}", mixedEndpointDescriptor)
+	vpn.HandleFunc("/{provider:[^/.]+}.{ext}", strategyDescriptorHandler(defaultStrategy))
+	vpn.HandleFunc("/random/{provider:[^/.]+}.{ext}", strategyDescriptorHandler("uniform"))
+	vpn.HandleFunc("/least-served/{provider:[^/.]+}.{ext}", strategyDescriptorHandler("least-served"))
+	vpn.HandleFunc("/{cc}/{provider:[^/.]+}.{ext}", strategyDescriptorHandler("per-country"))
+	shr.HandleFunc("/{uuid}/qr.{ext}", ExperimentQRHandler(db))
+	shr.HandleFunc("/{uuid:[^/.]+}.{ext}", DescriptorByUUIDHandler(db))
 	shr.HandleFunc("/{uuid}", DescriptorByUUIDHandler(db))
 
 	// status handlers
 	st.HandleFunc("/riseup/status/json", health.HealthQueryHandlerJSON(healthServiceMap, "riseup")).Queries("addr", "{addr}").Queries("tr", "{tr}")
 	st.HandleFunc("/riseup/summary", health.HealthSummaryHandlerText(healthServiceMap, "riseup"))
+	st.HandleFunc("/{provider}/coverage", coverageStatusHandler)
+	st.HandleFunc("/geoip", geoStatusHandler)
 
 	if skipTLS() {
 		log.Println("🚀 Starting web server at", listeningPort)
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"strings"
+
+	"github.com/spf13/viper"
+
+	"github.com/ainghazal/torii/share"
+)
+
+const defaultAuthor = "Ain Ghazal <ain@openobservatory.org>"
+
+// metadataTemplates are the text templates for the name, description and
+// author of a descriptor.
+type metadataTemplates struct {
+	Name        string
+	Description string
+	Author      string
+}
+
+// defaultMetadataTemplates are used when the config has none, and when a
+// configured template fails.
+var defaultMetadataTemplates = metadataTemplates{
+	Name:        "openvpn-{{.Provider}}",
+	Description: `{{if gt (len .Providers) 1}}compare vpn connections to {{join .Providers ", "}} gateways{{else}}measure vpn connection to {{.Provider}} gateways{{with .Country}} in {{.}}{{end}} ({{.Strategy}}){{end}}`,
+	Author:      defaultAuthor,
+}
+
+// descriptorMeta is the data the metadata templates are executed with.
+type descriptorMeta struct {
+	// Provider is the long name of the provider. In mixed descriptors, it
+	// is all the names joined with "-".
+	Provider   string
+	Providers  []string
+	Country    string
+	Strategy   string
+	Count      int
+	Experiment string
+
+	// providerKey selects the per-provider templates in the config.
+	providerKey string
+	// overrides are the templates of the experiment, if any.
+	overrides metadataTemplates
+}
+
+// newDescriptorMeta returns the metadata for a descriptor rendered with the
+// passed strategy. A country of "any" counts as no country.
+func newDescriptorMeta(providerKey, country, strategy string) *descriptorMeta {
+	if country == "any" {
+		country = ""
+	}
+	if strategy == "" {
+		strategy = defaultStrategy
+	}
+	return &descriptorMeta{providerKey: providerKey, Country: country, Strategy: strategy}
+}
+
+// metaFromExperiment returns the metadata for the descriptor of a shared
+// experiment, including its template overrides.
+func metaFromExperiment(exp *share.Experiment, strategy string) *descriptorMeta {
+	m := newDescriptorMeta(exp.Provider, exp.CountryCode, strategy)
+	m.Experiment = exp.Name
+	m.overrides = metadataTemplates{
+		Name:        exp.DescriptorName,
+		Description: exp.DescriptorDescription,
+		Author:      exp.DescriptorAuthor,
+	}
+	return m
+}
+
+// template returns the template for a field, in order of precedence: the
+// experiment override, the per-provider template under
+// descriptor.providers.<provider>.<field>, and descriptor.<field>.
+func (m *descriptorMeta) template(field, override string) string {
+	if override != "" {
+		return override
+	}
+	if m.providerKey != "" {
+		if t := viper.GetString("descriptor.providers." + m.providerKey + "." + field); t != "" {
+			return t
+		}
+	}
+	return viper.GetString("descriptor." + field)
+}
+
+// execute runs the template for a field, falling back to the default
+// template if it's missing or fails.
+func (m *descriptorMeta) execute(field, text, fallback string) string {
+	if text == "" {
+		text = fallback
+	}
+	out, err := m.run(field, text)
+	if err != nil {
+		log.Printf("ERROR: bad %s template: %v\n", field, err)
+		out, _ = m.run(field, fallback)
+	}
+	return out
+}
+
+func (m *descriptorMeta) run(field, text string) (string, error) {
+	t, err := share.ParseTemplate(field, text)
+	if err != nil {
+		return "", err
+	}
+	buf := &bytes.Buffer{}
+	if err := t.Execute(buf, m); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// apply sets the name, description and author of the config.
+func (m *descriptorMeta) apply(cfg *config) {
+	def := defaultMetadataTemplates
+	cfg.Name = m.execute("name", m.template("name", m.overrides.Name), def.Name)
+	cfg.Description = m.execute("description", m.template("description", m.overrides.Description), def.Description)
+	cfg.Author = m.execute("author", m.template("author", m.overrides.Author), def.Author)
+	cfg.shortDescription = m.shortDescription()
+}
+
+// shortDescription returns the providers, the country and the strategy of
+// the descriptor, e.g. "Riseup VPN in nl (per-country)".
+func (m *descriptorMeta) shortDescription() string {
+	s := strings.Join(m.Providers, ", ")
+	if m.Country != "" {
+		s += " in " + m.Country
+	}
+	if m.Strategy != "" {
+		s += " (" + m.Strategy + ")"
+	}
+	return s
+}
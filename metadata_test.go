@@ -0,0 +1,73 @@
+package main
+
+import "testing"
+
+func TestDescriptorMeta_apply(t *testing.T) {
+	tests := []struct {
+		name      string
+		meta      *descriptorMeta
+		wantName  string
+		wantDescr string
+		wantShort string
+	}{
+		{
+			name:      "defaults",
+			meta:      &descriptorMeta{Provider: "riseup", Providers: []string{"riseup"}, Strategy: "uniform"},
+			wantName:  "openvpn-riseup",
+			wantDescr: "measure vpn connection to riseup gateways (uniform)",
+			wantShort: "riseup (uniform)",
+		},
+		{
+			name:      "country",
+			meta:      &descriptorMeta{Provider: "riseup", Providers: []string{"riseup"}, Country: "nl", Strategy: "per-country"},
+			wantName:  "openvpn-riseup",
+			wantDescr: "measure vpn connection to riseup gateways in nl (per-country)",
+			wantShort: "riseup in nl (per-country)",
+		},
+		{
+			name:      "mixed",
+			meta:      &descriptorMeta{Provider: "riseup-tunnelbear", Providers: []string{"riseup", "tunnelbear"}},
+			wantName:  "openvpn-riseup-tunnelbear",
+			wantDescr: "compare vpn connections to riseup, tunnelbear gateways",
+			wantShort: "riseup, tunnelbear",
+		},
+		{
+			name: "experiment overrides",
+			meta: &descriptorMeta{
+				Provider: "riseup", Providers: []string{"riseup"}, Country: "nl", Count: 3, Experiment: "fluffy-foo",
+				overrides: metadataTemplates{Name: "{{.Experiment}}-{{upper .Country}}", Description: "{{.Count}} endpoints"},
+			},
+			wantName:  "fluffy-foo-NL",
+			wantDescr: "3 endpoints",
+			wantShort: "riseup in nl",
+		},
+		{
+			name: "bad override falls back",
+			meta: &descriptorMeta{
+				Provider: "riseup", Providers: []string{"riseup"}, Strategy: "uniform",
+				overrides: metadataTemplates{Name: "{{.Nope}}"},
+			},
+			wantName:  "openvpn-riseup",
+			wantDescr: "measure vpn connection to riseup gateways (uniform)",
+			wantShort: "riseup (uniform)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config{}
+			tt.meta.apply(cfg)
+			if cfg.Name != tt.wantName {
+				t.Errorf("Name = %q, want %q", cfg.Name, tt.wantName)
+			}
+			if cfg.Description != tt.wantDescr {
+				t.Errorf("Description = %q, want %q", cfg.Description, tt.wantDescr)
+			}
+			if cfg.shortDescription != tt.wantShort {
+				t.Errorf("shortDescription = %q, want %q", cfg.shortDescription, tt.wantShort)
+			}
+			if cfg.Author != defaultAuthor {
+				t.Errorf("Author = %q, want %q", cfg.Author, defaultAuthor)
+			}
+		})
+	}
+}
@@ -7,11 +7,27 @@ type config struct {
 	Description string    `json:"description"`
 	Author      string    `json:"author"`
 	NetTests    []netTest `json:"nettests"`
+
+	// selected are the endpoints behind the nettests, for the renderers
+	// that need more than the descriptor (e.g. openvpn profiles).
+	selected []selectedEndpoint
+	// shortDescription is a one-line summary, for the formats that show
+	// one next to the description (e.g. OONI Run).
+	shortDescription string
+}
+
+// selectedEndpoint is an endpoint together with the provider it came from.
+type selectedEndpoint struct {
+	provider vpn.Provider
+	endpoint *vpn.Endpoint
 }
 
 type netTest struct {
 	TestName string   `json:"test_name"`
 	Inputs   []string `json:"inputs"`
+	// PairID is shared by the nettests measuring variants of the same
+	// gateway, in paired descriptors.
+	PairID string `json:"pair_id,omitempty"`
 	// TODO these options can be generalized via an interface
 	Options vpn.Options `json:"options"`
 }
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/spf13/viper"
+
+	"github.com/ainghazal/torii/oonirun"
+)
+
+const formatOONIRunV2 = "oonirun-v2"
+
+// oonirunDescriptor converts a rendered config into an OONI Run v2
+// descriptor. The icon and color come from the oonirun_icon and
+// oonirun_color config keys. The pair id of a nettest, if any, is passed in
+// its backend options.
+func oonirunDescriptor(cfg *config) (*oonirun.Descriptor, error) {
+	d := &oonirun.Descriptor{
+		Name:                 cfg.Name,
+		ShortDescription:     cfg.shortDescription,
+		Description:          cfg.Description,
+		Author:               cfg.Author,
+		Icon:                 viper.GetString("oonirun_icon"),
+		Color:                viper.GetString("oonirun_color"),
+		NameIntl:             map[string]string{},
+		ShortDescriptionIntl: map[string]string{},
+		DescriptionIntl:      map[string]string{},
+		Nettests:             []oonirun.Nettest{},
+	}
+	for _, nt := range cfg.NetTests {
+		options, err := toObject(nt.Options)
+		if err != nil {
+			return nil, err
+		}
+		backendOptions := map[string]interface{}{}
+		if nt.PairID != "" {
+			backendOptions["pair_id"] = nt.PairID
+		}
+		d.Nettests = append(d.Nettests, oonirun.Nettest{
+			TestName:                  nt.TestName,
+			Inputs:                    nt.Inputs,
+			Options:                   options,
+			BackendOptions:            backendOptions,
+			IsManualRunEnabledDefault: true,
+		})
+	}
+	return d, d.Validate()
+}
+
+// toObject returns the JSON object that v is encoded as.
+func toObject(v interface{}) (map[string]interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	obj := map[string]interface{}{}
+	err = json.Unmarshal(b, &obj)
+	return obj, err
+}
+
+// writeOONIRunDescriptor writes the config as an OONI Run v2 descriptor.
+// Descriptors that do not pass validation are never served.
+func writeOONIRunDescriptor(w http.ResponseWriter, r *http.Request, cfg *config) error {
+	d, err := oonirunDescriptor(cfg)
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(w).Encode(d)
+}
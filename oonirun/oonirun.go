@@ -0,0 +1,106 @@
+// Package oonirun implements the OONI Run v2 descriptor format.
+package oonirun
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Descriptor is an OONI Run v2 descriptor.
+type Descriptor struct {
+	Name                 string            `json:"name"`
+	ShortDescription     string            `json:"short_description"`
+	Description          string            `json:"description"`
+	Author               string            `json:"author"`
+	Icon                 string            `json:"icon,omitempty"`
+	Color                string            `json:"color,omitempty"`
+	NameIntl             map[string]string `json:"name_intl"`
+	ShortDescriptionIntl map[string]string `json:"short_description_intl"`
+	DescriptionIntl      map[string]string `json:"description_intl"`
+	Nettests             []Nettest         `json:"nettests"`
+}
+
+// Nettest is a single nettest in a descriptor.
+type Nettest struct {
+	TestName                      string                 `json:"test_name"`
+	Inputs                        []string               `json:"inputs"`
+	Options                       map[string]interface{} `json:"options"`
+	BackendOptions                map[string]interface{} `json:"backend_options"`
+	IsBackgroundRunEnabledDefault bool                   `json:"is_background_run_enabled_default"`
+	IsManualRunEnabledDefault     bool                   `json:"is_manual_run_enabled_default"`
+}
+
+// ValidationError lists all the ways in which a descriptor does not follow
+// the spec.
+type ValidationError []string
+
+func (v ValidationError) Error() string {
+	return "oonirun: invalid descriptor: " + strings.Join(v, "; ")
+}
+
+var (
+	colorRe    = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+	testNameRe = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+	langRe     = regexp.MustCompile(`^[a-z]{2,3}([_-][A-Za-z0-9]{2,8})*$`)
+)
+
+// Validate checks the descriptor against the spec, and returns a
+// ValidationError if it's not valid.
+func (d *Descriptor) Validate() error {
+	var errs ValidationError
+	required := map[string]string{
+		"name":              d.Name,
+		"short_description": d.ShortDescription,
+		"description":       d.Description,
+		"author":            d.Author,
+	}
+	for _, field := range []string{"name", "short_description", "description", "author"} {
+		if strings.TrimSpace(required[field]) == "" {
+			errs = append(errs, field+" is required")
+		}
+	}
+	if d.Color != "" && !colorRe.MatchString(d.Color) {
+		errs = append(errs, fmt.Sprintf("color %q is not #RRGGBB", d.Color))
+	}
+	for field, intl := range map[string]map[string]string{
+		"name_intl":              d.NameIntl,
+		"short_description_intl": d.ShortDescriptionIntl,
+		"description_intl":       d.DescriptionIntl,
+	} {
+		if intl == nil {
+			errs = append(errs, field+" must be an object")
+		}
+		for lang := range intl {
+			if !langRe.MatchString(lang) {
+				errs = append(errs, fmt.Sprintf("%s: bad language %q", field, lang))
+			}
+		}
+	}
+	if len(d.Nettests) == 0 {
+		errs = append(errs, "nettests must not be empty")
+	}
+	for i, nt := range d.Nettests {
+		if !testNameRe.MatchString(nt.TestName) {
+			errs = append(errs, fmt.Sprintf("nettests[%d]: bad test_name %q", i, nt.TestName))
+		}
+		if nt.Inputs == nil {
+			errs = append(errs, fmt.Sprintf("nettests[%d]: inputs must be a list", i))
+		}
+		for j, input := range nt.Inputs {
+			if input == "" {
+				errs = append(errs, fmt.Sprintf("nettests[%d]: inputs[%d] is empty", i, j))
+			}
+		}
+		if nt.Options == nil {
+			errs = append(errs, fmt.Sprintf("nettests[%d]: options must be an object", i))
+		}
+		if nt.BackendOptions == nil {
+			errs = append(errs, fmt.Sprintf("nettests[%d]: backend_options must be an object", i))
+		}
+	}
+	if len(errs) != 0 {
+		return errs
+	}
+	return nil
+}
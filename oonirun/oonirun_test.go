@@ -0,0 +1,49 @@
+package oonirun
+
+import "testing"
+
+func validDescriptor() *Descriptor {
+	return &Descriptor{
+		Name:                 "openvpn-riseup",
+		ShortDescription:     "measure vpn connection",
+		Description:          "measure vpn connection to random riseup gateways",
+		Author:               "someone",
+		NameIntl:             map[string]string{},
+		ShortDescriptionIntl: map[string]string{},
+		DescriptionIntl:      map[string]string{"es": "medir conexión vpn"},
+		Nettests: []Nettest{{
+			TestName:       "openvpn",
+			Inputs:         []string{"vpn://openvpn.riseup/?addr=1.1.1.1:1194&transport=tcp"},
+			Options:        map[string]interface{}{},
+			BackendOptions: map[string]interface{}{},
+		}},
+	}
+}
+
+func TestDescriptor_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(*Descriptor)
+		wantErr bool
+	}{
+		{"valid", func(d *Descriptor) {}, false},
+		{"valid color", func(d *Descriptor) { d.Color = "#3b5bdb" }, false},
+		{"bad color", func(d *Descriptor) { d.Color = "blue" }, true},
+		{"missing author", func(d *Descriptor) { d.Author = "" }, true},
+		{"nil intl", func(d *Descriptor) { d.NameIntl = nil }, true},
+		{"bad language", func(d *Descriptor) { d.NameIntl = map[string]string{"Spanish": "x"} }, true},
+		{"no nettests", func(d *Descriptor) { d.Nettests = nil }, true},
+		{"bad test name", func(d *Descriptor) { d.Nettests[0].TestName = "Open VPN" }, true},
+		{"empty input", func(d *Descriptor) { d.Nettests[0].Inputs = []string{""} }, true},
+		{"nil options", func(d *Descriptor) { d.Nettests[0].Options = nil }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := validDescriptor()
+			tt.modify(d)
+			if err := d.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
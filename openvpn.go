@@ -0,0 +1,91 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/ainghazal/torii/ovpn"
+	"github.com/ainghazal/torii/vpn"
+)
+
+const (
+	paramPerEndpoint = "per_endpoint"
+
+	contentTypeOpenVPN = "application/x-openvpn-profile"
+)
+
+// openVPNProfiles returns the OpenVPN client profiles for the endpoints
+// behind a descriptor. Endpoints of the same provider share one profile, with
+// several remotes, unless perEndpoint is true. Endpoints that use an
+// obfuscated transport or another protocol are skipped, since a plain
+// OpenVPN client cannot reach them. Endpoints are picked with replacement, so
+// the same remote is only used once.
+func openVPNProfiles(cfg *config, perEndpoint bool) ([]profileFile, error) {
+	profiles := []profileFile{}
+	byProvider := map[string]*ovpn.Profile{}
+	seen := map[string]bool{}
+	for _, sel := range cfg.selected {
+		e := sel.endpoint
+		if e.Proto != "openvpn" || (e.Obfuscation != "" && e.Obfuscation != "none") {
+			log.Printf("WARN: skipping %s endpoint %s for openvpn profile\n", e.Obfuscation, e.IP)
+			continue
+		}
+		remote := ovpn.Remote{Host: e.IP, Port: e.Port, Proto: e.Transport}
+		name := sel.provider.Name()
+		key := endpointKey(name, e)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		if p, ok := byProvider[name]; ok && !perEndpoint {
+			p.Remotes = append(p.Remotes, remote)
+			continue
+		}
+		p, err := newOpenVPNProfile(sel.provider)
+		if err != nil {
+			return nil, err
+		}
+		p.Remotes = []ovpn.Remote{remote}
+		byProvider[name] = p
+		file := profileFileName("ovpn", name)
+		if perEndpoint {
+			file = profileFileName("ovpn", name, e.IP, e.Port, e.Transport)
+		}
+		profiles = append(profiles, profileFile{file, p})
+	}
+	return profiles, nil
+}
+
+// newOpenVPNProfile returns a profile without remotes, with the options and
+// credentials of the provider.
+func newOpenVPNProfile(provider vpn.Provider) (*ovpn.Profile, error) {
+	opt := optionsForProvider(provider.Name(), provider.Auth())
+	p := &ovpn.Profile{
+		Cipher:   opt.Cipher,
+		Auth:     opt.Auth,
+		Compress: opt.Compress,
+	}
+	var err error
+	if p.CA, err = vpn.FromBase64(opt.SafeCa); err != nil {
+		return nil, err
+	}
+	if p.Cert, err = vpn.FromBase64(opt.SafeCert); err != nil {
+		return nil, err
+	}
+	if p.Key, err = vpn.FromBase64(opt.SafeKey); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// writeOpenVPNProfiles writes the descriptor as OpenVPN client profiles (see
+// writeProfileFiles). With ?per_endpoint=1, every endpoint gets its own
+// profile.
+func writeOpenVPNProfiles(w http.ResponseWriter, r *http.Request, cfg *config) error {
+	profiles, err := openVPNProfiles(cfg, r.URL.Query().Get(paramPerEndpoint) == "1")
+	if err != nil {
+		return err
+	}
+	writeProfileFiles(w, profiles, contentTypeOpenVPN)
+	return nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/ainghazal/torii/ovpn"
+	"github.com/ainghazal/torii/vpn"
+)
+
+func Test_openVPNProfiles_duplicates(t *testing.T) {
+	riseup := vpn.NewCustomProvider("riseup")
+	a := &vpn.Endpoint{IP: "192.0.2.1", Port: "1194", Proto: "openvpn", Transport: "udp"}
+	b := &vpn.Endpoint{IP: "2001:db8::1", Port: "443", Proto: "openvpn", Transport: "tcp"}
+	cfg := &config{selected: []selectedEndpoint{{riseup, a}, {riseup, b}, {riseup, a}, {riseup, a.Copy()}}}
+
+	tests := []struct {
+		name        string
+		perEndpoint bool
+		wantFiles   []string
+		wantRemotes int
+	}{
+		{"shared profile", false, []string{"riseup.ovpn"}, 2},
+		{"per endpoint", true, []string{"riseup-192.0.2.1-1194-udp.ovpn", "riseup-2001_db8__1-443-tcp.ovpn"}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			profiles, err := openVPNProfiles(cfg, tt.perEndpoint)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(profiles) != len(tt.wantFiles) {
+				t.Fatalf("got %d profiles, want %d", len(profiles), len(tt.wantFiles))
+			}
+			for i, f := range profiles {
+				if f.name != tt.wantFiles[i] {
+					t.Errorf("profile %d is %s, want %s", i, f.name, tt.wantFiles[i])
+				}
+			}
+			if got := len(profiles[0].profile.(*ovpn.Profile).Remotes); got != tt.wantRemotes {
+				t.Errorf("first profile has %d remotes, want %d", got, tt.wantRemotes)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+// Package ovpn renders OpenVPN client profiles.
+package ovpn
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// Remote is a single remote line in a profile.
+type Remote struct {
+	Host  string
+	Port  string
+	Proto string
+}
+
+// Profile is a ready-to-use OpenVPN client profile. Credentials are inlined
+// as PEM blocks. If there's no client certificate, the profile asks for a
+// username and password instead.
+type Profile struct {
+	Remotes  []Remote
+	Cipher   string
+	Auth     string
+	Compress string
+	CA       []byte
+	Cert     []byte
+	Key      []byte
+}
+
+// compressDirectives maps the compression options used in descriptors to the
+// equivalent directives in a profile.
+var compressDirectives = map[string]string{
+	"comp-lzo-no": "comp-lzo no",
+	"comp-lzo":    "comp-lzo yes",
+	"stub":        "compress stub",
+	"stub-v2":     "compress stub-v2",
+	"lz4":         "compress lz4",
+	"lz4-v2":      "compress lz4-v2",
+}
+
+// WriteTo writes the profile in the OpenVPN configuration format.
+func (p *Profile) WriteTo(w io.Writer) (int64, error) {
+	buf := &bytes.Buffer{}
+	fmt.Fprintln(buf, "client")
+	fmt.Fprintln(buf, "dev tun")
+	fmt.Fprintln(buf, "nobind")
+	fmt.Fprintln(buf, "persist-key")
+	fmt.Fprintln(buf, "persist-tun")
+	fmt.Fprintln(buf, "remote-cert-tls server")
+	fmt.Fprintln(buf, "verb 3")
+	if len(p.Remotes) > 1 {
+		fmt.Fprintln(buf, "remote-random")
+	}
+	for _, r := range p.Remotes {
+		fmt.Fprintf(buf, "remote %s %s %s\n", r.Host, r.Port, r.Proto)
+	}
+	if p.Cipher != "" {
+		fmt.Fprintf(buf, "cipher %s\n", p.Cipher)
+		fmt.Fprintf(buf, "data-ciphers %s\n", p.Cipher)
+	}
+	if p.Auth != "" {
+		fmt.Fprintf(buf, "auth %s\n", p.Auth)
+	}
+	if p.Compress != "" {
+		directive, ok := compressDirectives[p.Compress]
+		if !ok {
+			directive = "compress " + p.Compress
+		}
+		fmt.Fprintln(buf, directive)
+	}
+	if len(p.Cert) == 0 {
+		fmt.Fprintln(buf, "auth-user-pass")
+	}
+	writeBlock(buf, "ca", p.CA)
+	writeBlock(buf, "cert", p.Cert)
+	writeBlock(buf, "key", p.Key)
+	return buf.WriteTo(w)
+}
+
+func writeBlock(buf *bytes.Buffer, tag string, pem []byte) {
+	if len(pem) == 0 {
+		return
+	}
+	fmt.Fprintf(buf, "<%s>\n", tag)
+	buf.Write(bytes.TrimSpace(pem))
+	fmt.Fprintf(buf, "\n</%s>\n", tag)
+}
@@ -0,0 +1,66 @@
+package ovpn
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestProfile_WriteTo(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile *Profile
+		want    []string
+		notWant []string
+	}{
+		{
+			"single remote with certificate",
+			&Profile{
+				Remotes:  []Remote{{"192.0.2.1", "1194", "udp"}},
+				Cipher:   "AES-256-GCM",
+				Compress: "comp-lzo-no",
+				CA:       []byte("ca\n"),
+				Cert:     []byte("cert"),
+				Key:      []byte("key"),
+			},
+			[]string{"remote 192.0.2.1 1194 udp\n", "data-ciphers AES-256-GCM\n", "comp-lzo no\n", "<ca>\nca\n</ca>\n", "<key>\nkey\n</key>\n"},
+			[]string{"remote-random", "auth-user-pass", "auth "},
+		},
+		{
+			"several remotes without certificate",
+			&Profile{
+				Remotes:  []Remote{{"192.0.2.1", "1194", "udp"}, {"2001:db8::1", "443", "tcp"}},
+				Compress: "zstd",
+				CA:       []byte("ca"),
+			},
+			[]string{"remote-random\n", "remote 2001:db8::1 443 tcp\n", "compress zstd\n", "auth-user-pass\n"},
+			[]string{"<cert>", "<key>", "cipher"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			n, err := tt.profile.WriteTo(buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != int64(buf.Len()) {
+				t.Errorf("WriteTo() = %d, wrote %d bytes", n, buf.Len())
+			}
+			got := buf.String()
+			if !strings.HasPrefix(got, "client\n") {
+				t.Errorf("WriteTo() does not start with client:\n%s", got)
+			}
+			for _, s := range tt.want {
+				if !strings.Contains(got, s) {
+					t.Errorf("WriteTo() lacks %q:\n%s", s, got)
+				}
+			}
+			for _, s := range tt.notWant {
+				if strings.Contains(got, s) {
+					t.Errorf("WriteTo() has %q:\n%s", s, got)
+				}
+			}
+		})
+	}
+}
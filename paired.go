@@ -0,0 +1,163 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/ainghazal/torii/vpn"
+)
+
+const (
+	paramVariants   = "variants"
+	defaultVariants = "tcp,udp"
+)
+
+// variant is a combination of transport and obfuscation.
+type variant struct {
+	Transport   string
+	Obfuscation string
+}
+
+func (v variant) String() string {
+	return v.Transport + ":" + v.Obfuscation
+}
+
+func (v variant) matches(e *vpn.Endpoint) bool {
+	return e.Transport == v.Transport && e.Obfuscation == v.Obfuscation
+}
+
+// parseVariants parses a list of variants in the form "tcp,udp" or
+// "tcp:none,tcp:obfs4". The obfuscation defaults to "none".
+func parseVariants(s string) ([]variant, error) {
+	variants := []variant{}
+	seen := make(map[variant]bool)
+	for _, item := range strings.Split(s, ",") {
+		tr, obfs, _ := strings.Cut(strings.TrimSpace(item), ":")
+		if obfs == "" {
+			obfs = "none"
+		}
+		if tr != "tcp" && tr != "udp" {
+			return nil, fmt.Errorf("bad transport in variant %q", item)
+		}
+		v := variant{tr, obfs}
+		if seen[v] {
+			continue
+		}
+		seen[v] = true
+		variants = append(variants, v)
+	}
+	if len(variants) < 2 {
+		return nil, fmt.Errorf("need at least two variants, got %q", s)
+	}
+	return variants, nil
+}
+
+// pairID returns a stable identifier for a gateway of a provider, so that
+// pairs can also be matched across descriptors.
+func pairID(provider, ip string) string {
+	sum := sha256.Sum256([]byte(provider + "/" + ip))
+	return hex.EncodeToString(sum[:4])
+}
+
+func init() {
+	registerStrategy(&strategy{
+		Name:        "paired",
+		Description: "picks gateways that offer every requested variant, and emits one endpoint per variant under a shared pair ID",
+		Params: []strategyParam{paramDocCountry, paramDocASN, {
+			Name:        paramMax,
+			Description: "number of gateways to pick",
+			Default:     "1",
+		}, {
+			Name:        paramVariants,
+			Description: "comma-separated transport[:obfuscation] variants, e.g. tcp,udp or tcp:none,tcp:obfs4",
+			Default:     defaultVariants,
+		}},
+		build: func(sp strategyParams) (endpointSelectorFn, error) {
+			v := sp.Extra.Get(paramVariants)
+			if v == "" {
+				v = defaultVariants
+			}
+			variants, err := parseVariants(v)
+			if err != nil {
+				return nil, err
+			}
+			filters := append([]namedFilter{byCountryFilter(sp.CountryCode)}, sp.Filters...)
+			return pairedEndpointPicker(variants, sp.maxOr(1), filters...), nil
+		},
+	})
+}
+
+// pairedEndpointPicker returns a provider selector that picks max distinct
+// gateways (by IP) offering all the passed variants, weighted by the mean
+// health score of their variants. The returned endpoints are copies that
+// carry the pair ID of their gateway, so that a blocked variant can be told
+// apart from a gateway that is down.
+func pairedEndpointPicker(variants []variant, max int, filters ...namedFilter) endpointSelectorFn {
+	return func(p vpn.Provider, tr *selectionTrace) []*vpn.Endpoint {
+		byGateway := make(map[string][]*vpn.Endpoint)
+		for _, e := range candidateEndpoints(p, filters, tr) {
+			byGateway[e.IP] = append(byGateway[e.IP], e)
+		}
+
+		// keep only the gateways that offer every variant
+		type gateway struct {
+			ip        string
+			endpoints []*vpn.Endpoint
+		}
+		eligible := []gateway{}
+		for ip, endpoints := range byGateway {
+			gw := gateway{ip: ip}
+			for _, v := range variants {
+				for _, e := range endpoints {
+					if v.matches(e) {
+						gw.endpoints = append(gw.endpoints, e)
+						break
+					}
+				}
+			}
+			if len(gw.endpoints) == len(variants) {
+				eligible = append(eligible, gw)
+			}
+		}
+		sort.Slice(eligible, func(i, j int) bool {
+			return eligible[i].ip < eligible[j].ip
+		})
+
+		weight := healthWeight(p.Name())
+		weights := make([]float64, len(eligible))
+		for i, gw := range eligible {
+			for _, e := range gw.endpoints {
+				weights[i] += weight(e) / float64(len(gw.endpoints))
+			}
+		}
+
+		res := []*vpn.Endpoint{}
+		for n := 0; n < max && len(eligible) > 0; n++ {
+			pick, roll := weightedPick(weights)
+			gw := eligible[pick]
+			id := pairID(p.Name(), gw.ip)
+			log.Printf("👯 Picked gateway %d/%d (pair %s)\n", pick+1, len(eligible), id)
+			tr.draw(traceDraw{
+				Provider: p.Name(),
+				Kind:     "paired",
+				Endpoint: gw.ip,
+				Pool:     len(eligible),
+				Roll:     roll,
+				Note:     "pair " + id,
+			})
+			for _, e := range gw.endpoints {
+				endp := e.Copy()
+				endp.PairID = id
+				res = append(res, endp)
+			}
+			// pick gateways without replacement
+			eligible = append(eligible[:pick], eligible[pick+1:]...)
+			weights = append(weights[:pick], weights[pick+1:]...)
+		}
+		return res
+	}
+}
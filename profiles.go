@@ -0,0 +1,73 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const contentTypeZip = "application/zip"
+
+// profileFile is a client profile together with the file name we serve it
+// as.
+type profileFile struct {
+	name    string
+	profile io.WriterTo
+}
+
+// profileFileName returns a file name made of the passed parts and
+// extension. Any character other than letters, digits, dots and dashes (e.g.
+// the colons of an IPv6 address, or path separators) is replaced with an
+// underscore, and the name never starts with a dot.
+func profileFileName(ext string, parts ...string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9', r == '.', r == '-':
+			return r
+		}
+		return '_'
+	}, strings.Join(parts, "-"))
+	if strings.HasPrefix(name, ".") {
+		name = "_" + name[1:]
+	}
+	return name + "." + ext
+}
+
+// writeProfileFiles writes a single profile as an attachment with the passed
+// content type, or a zip archive with one file per profile if there are
+// several of them.
+func writeProfileFiles(w http.ResponseWriter, files []profileFile, contentType string) {
+	if len(files) == 0 {
+		http.Error(w, errNotFoundStr, http.StatusNotFound)
+		return
+	}
+	if len(files) == 1 {
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", files[0].name))
+		files[0].profile.WriteTo(w)
+		return
+	}
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	for _, f := range files {
+		fw, err := zw.Create(f.name)
+		if err != nil {
+			http.Error(w, errorString(err), http.StatusInternalServerError)
+			return
+		}
+		if _, err := f.profile.WriteTo(fw); err != nil {
+			http.Error(w, errorString(err), http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := zw.Close(); err != nil {
+		http.Error(w, errorString(err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", contentTypeZip)
+	w.Header().Set("Content-Disposition", `attachment; filename="profiles.zip"`)
+	w.Write(buf.Bytes())
+}
@@ -0,0 +1,26 @@
+package main
+
+import "testing"
+
+func Test_profileFileName(t *testing.T) {
+	tests := []struct {
+		name  string
+		ext   string
+		parts []string
+		want  string
+	}{
+		{"ipv4", "ovpn", []string{"riseup", "192.0.2.1", "1194", "udp"}, "riseup-192.0.2.1-1194-udp.ovpn"},
+		{"ipv6", "ovpn", []string{"riseup", "2001:db8::1", "443", "tcp"}, "riseup-2001_db8__1-443-tcp.ovpn"},
+		{"hostname", "conf", []string{"riseup", "gw.example.org", "51820"}, "riseup-gw.example.org-51820.conf"},
+		{"path", "ovpn", []string{"../../etc/passwd"}, "_._.._etc_passwd.ovpn"},
+		{"quotes", "ovpn", []string{`a"b\c`}, "a_b_c.ovpn"},
+		{"provider only", "ovpn", []string{"tunnelbear"}, "tunnelbear.ovpn"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := profileFileName(tt.ext, tt.parts...); got != tt.want {
+				t.Errorf("profileFileName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
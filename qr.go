@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/skip2/go-qrcode"
+	"github.com/spf13/viper"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/ainghazal/torii/share"
+)
+
+const (
+	paramSize   = "size"
+	paramTarget = "target"
+
+	qrDefaultSize = 256
+	qrMinSize     = 64
+	qrMaxSize     = 1024
+)
+
+// shareURL returns the public url of the descriptor of an experiment.
+func shareURL(uuid string) string {
+	return publicURL() + "/share/" + uuid
+}
+
+// qrContent returns what the QR code of an experiment encodes: an OONI Run
+// deep link to the descriptor if the ooni_run_link_prefix key is set, or the
+// url of the descriptor otherwise. ?target=share always selects the latter.
+func qrContent(r *http.Request, uuid string) string {
+	link := shareURL(uuid)
+	prefix := viper.GetString("ooni_run_link_prefix")
+	if prefix == "" || r.URL.Query().Get(paramTarget) == "share" {
+		return link
+	}
+	return prefix + url.QueryEscape(link)
+}
+
+// qrSize returns the size in pixels asked for with ?size=, within bounds.
+func qrSize(r *http.Request) int {
+	size, err := strconv.Atoi(r.URL.Query().Get(paramSize))
+	if err != nil {
+		return qrDefaultSize
+	}
+	if size < qrMinSize {
+		return qrMinSize
+	}
+	if size > qrMaxSize {
+		return qrMaxSize
+	}
+	return size
+}
+
+// ExperimentQRHandler returns a handler that serves the QR code of a shared
+// experiment, as a png or an svg image depending on the extension.
+func ExperimentQRHandler(db *bolt.DB) httpHandler {
+	return func(w http.ResponseWriter, r *http.Request) {
+		uuid := getParam("uuid", r)
+		exp, err := share.GetExperiment(db, uuid, 0)
+		if err != nil {
+			http.Error(w, errNotFoundStr, http.StatusNotFound)
+			return
+		}
+		if exp.Deleted() {
+			writeDeletedExperiment(w, exp)
+			return
+		}
+		q, err := qrcode.New(qrContent(r, uuid), qrcode.Medium)
+		if err != nil {
+			http.Error(w, errorString(err), http.StatusInternalServerError)
+			return
+		}
+		switch getParam(paramExt, r) {
+		case "png":
+			png, err := q.PNG(qrSize(r))
+			if err != nil {
+				http.Error(w, errorString(err), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "image/png")
+			w.Write(png)
+		case "svg":
+			w.Header().Set("Content-Type", "image/svg+xml")
+			w.Write(qrSVG(q.Bitmap(), qrSize(r)))
+		default:
+			http.Error(w, errNotFoundStr, http.StatusNotFound)
+		}
+	}
+}
+
+// qrSVG draws a QR code bitmap as an svg image of the passed size, with one
+// path for all the dark modules.
+func qrSVG(bitmap [][]bool, size int) []byte {
+	buf := &bytes.Buffer{}
+	n := len(bitmap)
+	fmt.Fprintf(buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, size, size, n, n)
+	fmt.Fprintf(buf, `<rect width="%d" height="%d" fill="#fff"/><path fill="#000" d="`, n, n)
+	for y, row := range bitmap {
+		for x, dark := range row {
+			if dark {
+				fmt.Fprintf(buf, "M%d %dh1v1h-1z", x, y)
+			}
+		}
+	}
+	fmt.Fprint(buf, `"/></svg>`)
+	return buf.Bytes()
+}
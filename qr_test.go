@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func Test_shareURL(t *testing.T) {
+	defer viper.Reset()
+	tests := []struct {
+		name   string
+		config map[string]string
+		want   string
+	}{
+		{"public url", map[string]string{"public_url": "https://share.example.org/", "server_name": "example.org"}, "https://share.example.org/share/abc"},
+		{"server name", map[string]string{"server_name": "example.org"}, "https://example.org/share/abc"},
+		{"insecure", map[string]string{"server_name": "example.org", "insecure": "yes"}, "http://example.org/share/abc"},
+		{"nothing", map[string]string{"insecure": "yes"}, "http://localhost" + listeningPort + "/share/abc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Reset()
+			for k, v := range tt.config {
+				viper.Set(k, v)
+			}
+			if got := shareURL("abc"); got != tt.want {
+				t.Errorf("shareURL() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	viper.Reset()
+	viper.Set("server_name", "example.org")
+	viper.Set("ooni_run_link_prefix", "https://run.ooni.io/nettest?url=")
+	r := httptest.NewRequest(http.MethodGet, "http://attacker.example/share/abc/qr.svg", nil)
+	if got, want := qrContent(r, "abc"), "https://run.ooni.io/nettest?url=https%3A%2F%2Fexample.org%2Fshare%2Fabc"; got != want {
+		t.Errorf("qrContent() = %v, want %v", got, want)
+	}
+}
+
+func Test_qrSVG(t *testing.T) {
+	bitmap := [][]bool{
+		{true, false},
+		{false, true},
+	}
+	got := string(qrSVG(bitmap, 128))
+	for _, want := range []string{
+		`width="128" height="128" viewBox="0 0 2 2"`,
+		`d="M0 0h1v1h-1zM1 1h1v1h-1z"`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("qrSVG() = %s, want it to contain %s", got, want)
+		}
+	}
+	if !strings.HasPrefix(got, "<svg") || !strings.HasSuffix(got, "</svg>") {
+		t.Errorf("qrSVG() is not an svg element: %s", got)
+	}
+}
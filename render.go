@@ -2,8 +2,11 @@ package main
 
 import (
 	"errors"
-	"fmt"
+	"log"
+	"strings"
 
+	"github.com/ainghazal/torii/inputurl"
+	"github.com/ainghazal/torii/share"
 	"github.com/ainghazal/torii/vpn"
 )
 
@@ -35,35 +38,106 @@ func optionsForProvider(provider string, auth vpn.AuthDetails) vpn.Options {
 	return opt
 }
 
-func renderConfigForProvider(provider vpn.Provider, selector endpointSelectorFn) (*config, error) {
-	endpoints := selector(provider)
+// netTestForEndpoint returns a nettest for a single endpoint of the passed
+// provider, with the right options and auth for that provider.
+func netTestForEndpoint(provider vpn.Provider, endpoint *vpn.Endpoint) netTest {
+	return netTest{
+		TestName: endpoint.Proto, // one of: openvpn, wg
+		Inputs:   []string{inputURLForEndpoint(provider, endpoint).String()},
+		Options:  optionsForProvider(provider.Name(), provider.Auth()),
+		PairID:   endpoint.PairID,
+	}
+}
+
+// inputURLForEndpoint returns the nettest input for an endpoint.
+func inputURLForEndpoint(provider vpn.Provider, endpoint *vpn.Endpoint) *inputurl.InputURL {
+	return &inputurl.InputURL{
+		Proto:       endpoint.Proto,
+		Provider:    provider.Name(),
+		Addr:        endpoint.IP,
+		Port:        endpoint.Port,
+		Transport:   endpoint.Transport,
+		Obfuscation: endpoint.Obfuscation,
+	}
+}
+
+// renderConfigForProvider renders a descriptor with the endpoints picked by
+// selector from the provider. The metadata of the descriptor comes from the
+// templates, executed with meta (see metadata.go).
+func renderConfigForProvider(provider vpn.Provider, selector endpointSelectorFn, meta *descriptorMeta, tr *selectionTrace) (*config, error) {
+	endpoints := selector(provider, tr)
 	if len(endpoints) == 0 {
 		return nil, errors.New(errNoConfig)
 	}
-	auth := provider.Auth()
-
 	netTests := []netTest{}
+	selected := []selectedEndpoint{}
 
 	for _, endpoint := range endpoints {
-		test := netTest{
-			TestName: endpoint.Proto, // one of: openvpn, wg
-			Inputs: []string{
-				fmt.Sprintf(
-					"vpn://%s.%s/?addr=%s:%s&transport=%s",
-					endpoint.Proto,
-					provider.Name(),
-					endpoint.IP,
-					endpoint.Port,
-					endpoint.Transport,
-				)},
-			Options: optionsForProvider(provider.Name(), auth),
+		netTests = append(netTests, netTestForEndpoint(provider, endpoint))
+		selected = append(selected, selectedEndpoint{provider, endpoint})
+	}
+	meta.Provider = provider.LongName()
+	meta.Providers = []string{provider.LongName()}
+	meta.Count = len(netTests)
+	cfg := &config{
+		NetTests: netTests,
+		selected: selected,
+	}
+	meta.apply(cfg)
+	return cfg, nil
+}
+
+// providerQuota is the number of endpoints to draw from a provider in a
+// mixed descriptor.
+type providerQuota struct {
+	Provider vpn.Provider
+	Count    int
+}
+
+// parseProviderQuotas parses a list of quotas in the form
+// "riseup:2,tunnelbear:1" (see share.ParseMix).
+func parseProviderQuotas(s string) ([]providerQuota, error) {
+	mix, err := share.ParseMix(s)
+	if err != nil {
+		return nil, err
+	}
+	quotas := []providerQuota{}
+	for _, m := range mix {
+		quotas = append(quotas, providerQuota{vpn.Providers[m.Provider], m.Count})
+	}
+	return quotas, nil
+}
+
+// renderMixedConfig renders a single descriptor with endpoints drawn from
+// several providers. selectorFor returns the selector used to pick count
+// endpoints from a given provider.
+func renderMixedConfig(quotas []providerQuota, selectorFor func(p vpn.Provider, count int) endpointSelectorFn, meta *descriptorMeta, tr *selectionTrace) (*config, error) {
+	netTests := []netTest{}
+	selected := []selectedEndpoint{}
+	names := []string{}
+
+	for _, q := range quotas {
+		endpoints := selectorFor(q.Provider, q.Count)(q.Provider, tr)
+		if len(endpoints) == 0 {
+			log.Printf("WARN: no endpoints for %s in mixed descriptor\n", q.Provider.Name())
+			continue
+		}
+		for _, endpoint := range endpoints {
+			netTests = append(netTests, netTestForEndpoint(q.Provider, endpoint))
+			selected = append(selected, selectedEndpoint{q.Provider, endpoint})
 		}
-		netTests = append(netTests, test)
+		names = append(names, q.Provider.LongName())
+	}
+	if len(netTests) == 0 {
+		return nil, errors.New(errNoConfig)
+	}
+	meta.Provider = strings.Join(names, "-")
+	meta.Providers = names
+	meta.Count = len(netTests)
+	cfg := &config{
+		NetTests: netTests,
+		selected: selected,
 	}
-	return &config{
-		Name:        fmt.Sprintf("openvpn-%s", provider.LongName()),
-		Description: fmt.Sprintf("measure vpn connection to random %s gateways", provider.LongName()),
-		Author:      authorName,
-		NetTests:    netTests,
-	}, nil
+	meta.apply(cfg)
+	return cfg, nil
 }
@@ -0,0 +1,251 @@
+// Package rules implements an admin-managed set of rules that exclude or
+// allow endpoints during selection.
+package rules
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ainghazal/torii/vpn"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	rulesBucket = "rules"
+
+	// ActionDeny excludes the matching endpoints.
+	ActionDeny = "deny"
+	// ActionAllow restricts the pool of a provider to the matching endpoints.
+	ActionAllow = "allow"
+)
+
+var (
+	errBadAction = errors.New("action must be allow or deny")
+	errNoReason  = errors.New("a reason is needed")
+	errBadCIDR   = errors.New("bad cidr")
+	errBadPort   = errors.New("bad port")
+	errNotFound  = errors.New("rule not found")
+)
+
+// Rule matches endpoints by provider, network, port, transport or label. An
+// empty field matches anything. A rule stops matching after Expires, if set.
+type Rule struct {
+	ID        int        `json:"id"`
+	Action    string     `json:"action"`
+	Provider  string     `json:"provider,omitempty"`
+	CIDR      string     `json:"cidr,omitempty"`
+	Port      string     `json:"port,omitempty"`
+	Transport string     `json:"transport,omitempty"`
+	Label     string     `json:"label,omitempty"`
+	Reason    string     `json:"reason"`
+	Expires   *time.Time `json:"expires,omitempty"`
+	Created   time.Time  `json:"created"`
+
+	network *net.IPNet
+}
+
+// Validate checks that the rule is well formed, and prepares it for matching.
+func (r *Rule) Validate() error {
+	if r.Action != ActionDeny && r.Action != ActionAllow {
+		return errBadAction
+	}
+	if r.Reason == "" {
+		return errNoReason
+	}
+	if r.CIDR != "" {
+		_, network, err := net.ParseCIDR(r.CIDR)
+		if err != nil {
+			return fmt.Errorf("%w: %s", errBadCIDR, r.CIDR)
+		}
+		r.network = network
+	}
+	if r.Port != "" {
+		// ports are matched as strings, so only the canonical form can match
+		port, err := strconv.Atoi(r.Port)
+		if err != nil || port < 1 || port > 65535 || strconv.Itoa(port) != r.Port {
+			return fmt.Errorf("%w: %s", errBadPort, r.Port)
+		}
+	}
+	return nil
+}
+
+// Active returns true if the rule has not expired at the given time.
+func (r *Rule) Active(now time.Time) bool {
+	return r.Expires == nil || now.Before(*r.Expires)
+}
+
+// Matches returns true if the rule matches the endpoint of the passed
+// provider.
+func (r *Rule) Matches(provider string, e *vpn.Endpoint) bool {
+	if r.Provider != "" && r.Provider != provider {
+		return false
+	}
+	if r.network != nil && !r.network.Contains(net.ParseIP(e.IP)) {
+		return false
+	}
+	if r.Port != "" && r.Port != e.Port {
+		return false
+	}
+	if r.Transport != "" && r.Transport != e.Transport {
+		return false
+	}
+	if r.Label != "" && r.Label != e.Label {
+		return false
+	}
+	return true
+}
+
+// Store persists rules in a bbolt bucket, and keeps a copy in memory so that
+// they can be applied on every selection.
+type Store struct {
+	db    *bolt.DB
+	mu    sync.RWMutex
+	rules []*Rule
+}
+
+// NewStore returns a Store backed by the passed database. If the bucket does
+// not exist yet, it is created and populated with the seed rules.
+func NewStore(db *bolt.DB, seed []*Rule) (*Store, error) {
+	s := &Store{db: db}
+	created := false
+	err := db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte(rulesBucket)) != nil {
+			return nil
+		}
+		_, err := tx.CreateBucket([]byte(rulesBucket))
+		if err != nil {
+			return fmt.Errorf("create bucket: %s", err)
+		}
+		created = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if created {
+		for _, r := range seed {
+			if err := s.Add(r); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return s, s.load()
+}
+
+func (s *Store) load() error {
+	rules := []*Rule{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(rulesBucket)).ForEach(func(k, v []byte) error {
+			r := &Rule{}
+			if err := json.Unmarshal(v, r); err != nil {
+				return err
+			}
+			if err := r.Validate(); err != nil {
+				// ports out of range used to be accepted; such rules
+				// never matched, and must not keep the server from
+				// starting
+				log.Printf("WARN: skipping rule %d: %v\n", r.ID, err)
+				return nil
+			}
+			rules = append(rules, r)
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rules = rules
+	return nil
+}
+
+// Add validates and persists a new rule, assigning it an ID.
+func (s *Store) Add(r *Rule) error {
+	if err := r.Validate(); err != nil {
+		return err
+	}
+	r.Created = time.Now().UTC()
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(rulesBucket))
+		id, _ := b.NextSequence()
+		r.ID = int(id)
+		buf, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		return b.Put(itob(r.ID), buf)
+	})
+	if err != nil {
+		return err
+	}
+	return s.load()
+}
+
+// Delete removes the rule with the passed ID.
+func (s *Store) Delete(id int) error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(rulesBucket))
+		if b.Get(itob(id)) == nil {
+			return errNotFound
+		}
+		return b.Delete(itob(id))
+	})
+	if err != nil {
+		return err
+	}
+	return s.load()
+}
+
+// List returns all the rules, including the expired ones.
+func (s *Store) List() []*Rule {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]*Rule{}, s.rules...)
+}
+
+// Check returns whether the endpoint of the passed provider is allowed by the
+// active rules. A matching deny rule always excludes the endpoint. If there
+// are active allow rules for the provider, the endpoint has to match one of
+// them. The rule that excluded the endpoint is returned, if any.
+func (s *Store) Check(provider string, e *vpn.Endpoint) (bool, *Rule) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	now := time.Now()
+	hasAllow, allowed := false, false
+	for _, r := range s.rules {
+		if !r.Active(now) {
+			continue
+		}
+		if r.Action == ActionAllow && (r.Provider == "" || r.Provider == provider) {
+			hasAllow = true
+			if r.Matches(provider, e) {
+				allowed = true
+			}
+			continue
+		}
+		if r.Action == ActionDeny && r.Matches(provider, e) {
+			return false, r
+		}
+	}
+	return !hasAllow || allowed, nil
+}
+
+// IsNotFound returns true if the error means that a rule does not exist.
+func IsNotFound(err error) bool {
+	return errors.Is(err, errNotFound)
+}
+
+// itob returns an 8-byte big endian representation of v.
+func itob(v int) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(v))
+	return b
+}
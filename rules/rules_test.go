@@ -0,0 +1,131 @@
+package rules
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ainghazal/torii/vpn"
+	bolt "go.etcd.io/bbolt"
+)
+
+func newTestStore(t *testing.T, seed []*Rule) *Store {
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "test.db"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	s, err := NewStore(db, seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestStore_Check(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	s := newTestStore(t, []*Rule{
+		{Action: ActionDeny, Provider: "riseup", Port: "53", Reason: "dns"},
+		{Action: ActionDeny, CIDR: "10.0.0.0/8", Reason: "private"},
+		{Action: ActionDeny, Label: "expired", Reason: "old", Expires: &past},
+		{Action: ActionAllow, Provider: "tunnelbear", Transport: "udp", Reason: "udp only"},
+	})
+	tests := []struct {
+		name     string
+		provider string
+		endpoint *vpn.Endpoint
+		want     bool
+	}{
+		{
+			name:     "denied by port",
+			provider: "riseup",
+			endpoint: &vpn.Endpoint{IP: "1.1.1.1", Port: "53", Transport: "udp"},
+			want:     false,
+		},
+		{
+			name:     "port rule is scoped to provider",
+			provider: "custom",
+			endpoint: &vpn.Endpoint{IP: "1.1.1.1", Port: "53", Transport: "udp"},
+			want:     true,
+		},
+		{
+			name:     "denied by cidr",
+			provider: "riseup",
+			endpoint: &vpn.Endpoint{IP: "10.1.2.3", Port: "443", Transport: "tcp"},
+			want:     false,
+		},
+		{
+			name:     "expired rules do not apply",
+			provider: "riseup",
+			endpoint: &vpn.Endpoint{Label: "expired", IP: "1.1.1.1", Port: "443"},
+			want:     true,
+		},
+		{
+			name:     "allowlist lets matching endpoints through",
+			provider: "tunnelbear",
+			endpoint: &vpn.Endpoint{IP: "1.1.1.1", Port: "443", Transport: "udp"},
+			want:     true,
+		},
+		{
+			name:     "allowlist excludes the rest",
+			provider: "tunnelbear",
+			endpoint: &vpn.Endpoint{IP: "1.1.1.1", Port: "443", Transport: "tcp"},
+			want:     false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, _ := s.Check(tt.provider, tt.endpoint); got != tt.want {
+				t.Errorf("Check() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStore_AddDelete(t *testing.T) {
+	s := newTestStore(t, nil)
+	if err := s.Add(&Rule{Action: "block", Reason: "x"}); err != errBadAction {
+		t.Errorf("Add() err = %v, want %v", err, errBadAction)
+	}
+	r := &Rule{Action: ActionDeny, Port: "80", Reason: "x"}
+	if err := s.Add(r); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.List()) != 1 {
+		t.Fatalf("List() has %d rules, want 1", len(s.List()))
+	}
+	if err := s.Delete(r.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete(r.ID); !IsNotFound(err) {
+		t.Errorf("Delete() err = %v, want not found", err)
+	}
+}
+
+func TestRule_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    *Rule
+		wantErr error
+	}{
+		{"valid", &Rule{Action: ActionDeny, Port: "53", CIDR: "10.0.0.0/8", Reason: "r"}, nil},
+		{"bad action", &Rule{Action: "drop", Reason: "r"}, errBadAction},
+		{"no reason", &Rule{Action: ActionDeny}, errNoReason},
+		{"bad cidr", &Rule{Action: ActionDeny, CIDR: "10.0.0.0", Reason: "r"}, errBadCIDR},
+		{"lowest port", &Rule{Action: ActionDeny, Port: "1", Reason: "r"}, nil},
+		{"highest port", &Rule{Action: ActionDeny, Port: "65535", Reason: "r"}, nil},
+		{"port zero", &Rule{Action: ActionDeny, Port: "0", Reason: "r"}, errBadPort},
+		{"negative port", &Rule{Action: ActionDeny, Port: "-53", Reason: "r"}, errBadPort},
+		{"port too high", &Rule{Action: ActionDeny, Port: "65536", Reason: "r"}, errBadPort},
+		{"leading zero", &Rule{Action: ActionDeny, Port: "053", Reason: "r"}, errBadPort},
+		{"not a number", &Rule{Action: ActionDeny, Port: "dns", Reason: "r"}, errBadPort},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.rule.Validate(); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Validate() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+
+	"github.com/ainghazal/torii/schema"
+)
+
+const descriptorSchemaID = "/schema/descriptor.json"
+
+// descriptorSchema is the schema of the descriptors in the json format,
+// generated from the config type.
+var descriptorSchema = schema.Generate(config{}, descriptorSchemaID, "torii vpn descriptor")
+
+// validateDescriptor checks an encoded descriptor against the schema, in
+// debug mode only.
+func validateDescriptor(body []byte) error {
+	if os.Getenv("DEBUG") != "1" {
+		return nil
+	}
+	return descriptorSchema.Validate(body)
+}
+
+func descriptorSchemaHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/schema+json")
+	json.NewEncoder(w).Encode(descriptorSchema)
+}
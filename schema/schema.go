@@ -0,0 +1,191 @@
+// Package schema generates JSON Schemas from Go types, and validates JSON
+// documents against them. Only the subset of JSON Schema that the generator
+// emits is supported: types, properties, required properties, items and
+// additionalProperties.
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+const draft = "https://json-schema.org/draft/2020-12/schema"
+
+// Schema is a JSON Schema.
+type Schema struct {
+	Draft      string             `json:"$schema,omitempty"`
+	ID         string             `json:"$id,omitempty"`
+	Title      string             `json:"title,omitempty"`
+	Type       string             `json:"type"`
+	Properties map[string]*Schema `json:"properties,omitempty"`
+	Required   []string           `json:"required,omitempty"`
+	Items      *Schema            `json:"items,omitempty"`
+	// AdditionalProperties is false for structs, and the schema of the
+	// values for maps.
+	AdditionalProperties interface{} `json:"additionalProperties,omitempty"`
+}
+
+// Generate returns the schema of the JSON encoding of v, following the json
+// struct tags. Unexported and "-" fields are skipped, and fields without
+// omitempty are required.
+func Generate(v interface{}, id, title string) *Schema {
+	s := forType(reflect.TypeOf(v))
+	s.Draft = draft
+	s.ID = id
+	s.Title = title
+	return s
+}
+
+func forType(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: forType(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: forType(t.Elem())}
+	case reflect.Struct:
+		s := &Schema{Type: "object", Properties: map[string]*Schema{}, AdditionalProperties: false}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+			name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if name == "-" && opts == "" {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			s.Properties[name] = forType(f.Type)
+			if !strings.Contains(opts, "omitempty") {
+				s.Required = append(s.Required, name)
+			}
+		}
+		sort.Strings(s.Required)
+		return s
+	}
+	// anything else (interfaces, etc.) can be any value
+	return &Schema{}
+}
+
+// ValidationError lists all the ways in which a document does not follow a
+// schema.
+type ValidationError []string
+
+func (v ValidationError) Error() string {
+	return "schema: " + strings.Join(v, "; ")
+}
+
+// Validate checks a JSON document against the schema, and returns a
+// ValidationError if it does not follow it.
+func (s *Schema) Validate(data []byte) error {
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	var errs ValidationError
+	s.validate("$", doc, &errs)
+	if len(errs) != 0 {
+		return errs
+	}
+	return nil
+}
+
+func (s *Schema) validate(path string, v interface{}, errs *ValidationError) {
+	fail := func(format string, a ...interface{}) {
+		*errs = append(*errs, path+": "+fmt.Sprintf(format, a...))
+	}
+	switch s.Type {
+	case "":
+		return
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			fail("want boolean, got %s", typeOf(v))
+		}
+	case "integer":
+		n, ok := v.(float64)
+		if !ok || n != float64(int64(n)) {
+			fail("want integer, got %s", typeOf(v))
+		}
+	case "number":
+		if _, ok := v.(float64); !ok {
+			fail("want number, got %s", typeOf(v))
+		}
+	case "string":
+		if _, ok := v.(string); !ok {
+			fail("want string, got %s", typeOf(v))
+		}
+	case "array":
+		a, ok := v.([]interface{})
+		if !ok {
+			fail("want array, got %s", typeOf(v))
+			return
+		}
+		for i, item := range a {
+			s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item, errs)
+		}
+	case "object":
+		o, ok := v.(map[string]interface{})
+		if !ok {
+			fail("want object, got %s", typeOf(v))
+			return
+		}
+		for _, name := range s.Required {
+			if _, ok := o[name]; !ok {
+				fail("missing property %q", name)
+			}
+		}
+		keys := make([]string, 0, len(o))
+		for k := range o {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if prop, ok := s.Properties[k]; ok {
+				prop.validate(path+"."+k, o[k], errs)
+				continue
+			}
+			switch ap := s.AdditionalProperties.(type) {
+			case bool:
+				if !ap {
+					fail("unexpected property %q", k)
+				}
+			case *Schema:
+				ap.validate(path+"."+k, o[k], errs)
+			}
+		}
+	}
+}
+
+func typeOf(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
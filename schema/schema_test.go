@@ -0,0 +1,43 @@
+package schema
+
+import "testing"
+
+type inner struct {
+	Port int `json:"port"`
+}
+
+type doc struct {
+	Name    string            `json:"name"`
+	Tags    []string          `json:"tags"`
+	Inner   inner             `json:"inner"`
+	Extra   map[string]string `json:"extra,omitempty"`
+	Comment string            `json:",omitempty"`
+	Skipped string            `json:"-"`
+	hidden  string
+}
+
+func TestSchema_Validate(t *testing.T) {
+	s := Generate(doc{}, "https://example.org/doc.json", "doc")
+	tests := []struct {
+		name    string
+		data    string
+		wantErr bool
+	}{
+		{"valid", `{"name":"a","tags":["x"],"inner":{"port":1}}`, false},
+		{"valid optional", `{"name":"a","tags":[],"inner":{"port":1},"extra":{"k":"v"},"Comment":"c"}`, false},
+		{"missing required", `{"name":"a","inner":{"port":1}}`, true},
+		{"wrong type", `{"name":1,"tags":[],"inner":{"port":1}}`, true},
+		{"wrong item type", `{"name":"a","tags":[1],"inner":{"port":1}}`, true},
+		{"not an integer", `{"name":"a","tags":[],"inner":{"port":1.5}}`, true},
+		{"unexpected property", `{"name":"a","tags":[],"inner":{"port":1},"Skipped":"x"}`, true},
+		{"wrong map value", `{"name":"a","tags":[],"inner":{"port":1},"extra":{"k":1}}`, true},
+		{"not json", `{`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := s.Validate([]byte(tt.data)); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/ainghazal/torii/vpn"
+)
+
+func TestDescriptorSchema(t *testing.T) {
+	pick := func(e ...*vpn.Endpoint) endpointSelectorFn {
+		return func(vpn.Provider, *selectionTrace) []*vpn.Endpoint {
+			return e
+		}
+	}
+	riseup := vpn.NewCustomProvider("riseup")
+	tunnelbear := vpn.NewCustomProvider("tunnelbear")
+	plain := &vpn.Endpoint{IP: "1.1.1.1", Port: "1194", Proto: "openvpn", Transport: "tcp", Obfuscation: "none"}
+	paired := &vpn.Endpoint{IP: "2001:db8::1", Port: "443", Proto: "openvpn", Transport: "udp", PairID: "abcd1234"}
+
+	tests := []struct {
+		name   string
+		render func() (*config, error)
+	}{
+		{"single", func() (*config, error) {
+			return renderConfigForProvider(riseup, pick(plain), newDescriptorMeta("riseup", "", ""), nil)
+		}},
+		{"paired", func() (*config, error) {
+			return renderConfigForProvider(riseup, pick(plain, paired), newDescriptorMeta("riseup", "nl", "paired"), nil)
+		}},
+		{"mixed", func() (*config, error) {
+			quotas := []providerQuota{{riseup, 1}, {tunnelbear, 1}}
+			return renderMixedConfig(quotas, func(vpn.Provider, int) endpointSelectorFn { return pick(plain) }, newDescriptorMeta("", "", ""), nil)
+		}},
+		{"secret-free", func() (*config, error) {
+			cfg, err := renderConfigForProvider(riseup, pick(plain), newDescriptorMeta("riseup", "", ""), nil)
+			if err == nil {
+				cfg.NetTests[0].Options.CredentialsURL = "https://example.org/api/credentials"
+				cfg.NetTests[0].Options.CredentialsToken = "token"
+			}
+			return cfg, err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := tt.render()
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, err := encodeConfig(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := descriptorSchema.Validate(body); err != nil {
+				t.Errorf("Validate() error = %v\n%s", err, body)
+			}
+		})
+	}
+}
+
+func TestDescriptorSchema_rejects(t *testing.T) {
+	for _, body := range []string{
+		`{"name":"a","description":"b","author":"c"}`,
+		`{"name":"a","description":"b","author":"c","nettests":[{"test_name":"openvpn","inputs":[],"options":{"cipher":"AES-256-GCM"}}]}`,
+	} {
+		if err := descriptorSchema.Validate([]byte(body)); err == nil {
+			t.Errorf("Validate(%s) did not fail", body)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/ainghazal/torii/vpn"
+	"github.com/spf13/viper"
+)
+
+const (
+	// historySize is the number of checks we remember for each endpoint.
+	historySize = 32
+
+	// unknownScore is the score for endpoints with no (recent) history.
+	unknownScore = 0.5
+
+	// recencyHalfLife is the age at which a check weighs half as much as a
+	// fresh one.
+	recencyHalfLife = time.Hour
+
+	// referenceLatency is the check latency that halves the score of an
+	// endpoint.
+	referenceLatency = 2 * time.Second
+
+	defaultScoreFloor = 0.05
+)
+
+type endpointWeightFn func(*vpn.Endpoint) float64
+
+func uniformWeight(*vpn.Endpoint) float64 {
+	return 1
+}
+
+// checkRecord is a single observation of the health of an endpoint.
+type checkRecord struct {
+	OK      bool
+	Latency time.Duration
+	At      time.Time
+}
+
+// healthHistory keeps the last historySize checks for every endpoint.
+type healthHistory struct {
+	mu      sync.Mutex
+	records map[string][]checkRecord
+}
+
+var endpointHistory = &healthHistory{records: make(map[string][]checkRecord)}
+
+func endpointKey(provider string, e *vpn.Endpoint) string {
+	return fmt.Sprintf("%s/%s:%s/%s", provider, e.IP, e.Port, e.Transport)
+}
+
+func (h *healthHistory) record(key string, r checkRecord) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	rec := append(h.records[key], r)
+	if len(rec) > historySize {
+		rec = rec[len(rec)-historySize:]
+	}
+	h.records[key] = rec
+}
+
+func (h *healthHistory) get(key string) []checkRecord {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]checkRecord{}, h.records[key]...)
+}
+
+// scoreFromHistory returns a score between 0 and 1 for the passed check
+// history. Every check is weighted by its age, so that old failures are
+// slowly forgiven; the success ratio is then penalized by the mean latency of
+// the successful checks. As the newest check gets older, the score drifts
+// back towards unknownScore.
+func scoreFromHistory(records []checkRecord, now time.Time) float64 {
+	if len(records) == 0 {
+		return unknownScore
+	}
+	var total, ok, latency float64
+	newest := records[0].At
+	for _, r := range records {
+		w := decay(now.Sub(r.At))
+		total += w
+		if r.OK {
+			ok += w
+			latency += w * float64(r.Latency)
+		}
+		if r.At.After(newest) {
+			newest = r.At
+		}
+	}
+	if total == 0 {
+		return unknownScore
+	}
+	score := ok / total
+	if ok > 0 {
+		meanLatency := latency / ok
+		score *= float64(referenceLatency) / (float64(referenceLatency) + meanLatency)
+	}
+	freshness := decay(now.Sub(newest))
+	return freshness*score + (1-freshness)*unknownScore
+}
+
+func decay(age time.Duration) float64 {
+	if age < 0 {
+		age = 0
+	}
+	return math.Exp2(-float64(age) / float64(recencyHalfLife))
+}
+
+// scoreFloor returns the minimum weight that any endpoint gets during
+// selection, as configured with the score_floor key.
+func scoreFloor() float64 {
+	return math.Max(0, viper.GetFloat64("score_floor"))
+}
+
+// healthWeight returns a function that scores endpoints of the given provider
+// according to their check history. Providers without health checks get a
+// uniform weight. Weights never go below score_floor: blocking measurements
+// need some broken endpoints too.
+func healthWeight(provider string) endpointWeightFn {
+	if snapshotFor(provider) == nil {
+		return uniformWeight
+	}
+	floor := scoreFloor()
+	now := time.Now()
+	return func(endp *vpn.Endpoint) float64 {
+		key := endpointKey(provider, endp)
+		return math.Max(floor, scoreFromHistory(endpointHistory.get(key), now))
+	}
+}
+
+// weightedPick returns an index into weights, chosen with a probability
+// proportional to its weight, and the random roll in [0, 1) that chose it.
+func weightedPick(weights []float64) (int, float64) {
+	var sum float64
+	for _, w := range weights {
+		sum += w
+	}
+	roll := rand.Float64()
+	if sum <= 0 {
+		return int(roll * float64(len(weights))), roll
+	}
+	acc := roll * sum
+	for i, w := range weights {
+		if acc < w {
+			return i, roll
+		}
+		acc -= w
+	}
+	return len(weights) - 1, roll
+}
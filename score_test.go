@@ -0,0 +1,81 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_scoreFromHistory(t *testing.T) {
+	now := time.Now()
+	fresh := func(ok bool, latency time.Duration) checkRecord {
+		return checkRecord{OK: ok, Latency: latency, At: now}
+	}
+	tests := []struct {
+		name    string
+		records []checkRecord
+		wantMin float64
+		wantMax float64
+	}{
+		{
+			name:    "no history gets the unknown score",
+			records: []checkRecord{},
+			wantMin: unknownScore,
+			wantMax: unknownScore,
+		},
+		{
+			name:    "fast and healthy scores high",
+			records: []checkRecord{fresh(true, 0), fresh(true, 0)},
+			wantMin: 0.99,
+			wantMax: 1,
+		},
+		{
+			name:    "always failing scores zero",
+			records: []checkRecord{fresh(false, 0), fresh(false, 0)},
+			wantMin: 0,
+			wantMax: 0,
+		},
+		{
+			name:    "half failing scores half",
+			records: []checkRecord{fresh(true, 0), fresh(false, 0)},
+			wantMin: 0.49,
+			wantMax: 0.51,
+		},
+		{
+			name:    "slow endpoints are penalized",
+			records: []checkRecord{fresh(true, referenceLatency)},
+			wantMin: 0.49,
+			wantMax: 0.51,
+		},
+		{
+			name:    "only successful checks count for latency",
+			records: []checkRecord{fresh(true, referenceLatency), fresh(false, time.Minute)},
+			wantMin: 0.24,
+			wantMax: 0.26,
+		},
+		{
+			name: "old failures drift back to unknown",
+			records: []checkRecord{
+				{OK: false, At: now.Add(-24 * time.Hour)},
+			},
+			wantMin: unknownScore - 0.01,
+			wantMax: unknownScore,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := scoreFromHistory(tt.records, now)
+			if got < tt.wantMin || got > tt.wantMax {
+				t.Errorf("scoreFromHistory() = %v, want in [%v, %v]", got, tt.wantMin, tt.wantMax)
+			}
+		})
+	}
+}
+
+func Test_weightedPick(t *testing.T) {
+	weights := []float64{0, 1, 0}
+	for i := 0; i < 100; i++ {
+		if got, _ := weightedPick(weights); got != 1 {
+			t.Fatalf("weightedPick() = %v, want 1", got)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"sort"
+
+	"github.com/ainghazal/torii/coverage"
+	"github.com/ainghazal/torii/vpn"
+)
+
+// servedStore keeps per-endpoint counts of how often each endpoint was
+// served. It is nil if the store could not be initialized.
+var servedStore *coverage.Store
+
+// recordServed increments the serving count of the endpoints behind a
+// descriptor. It's called once the descriptor is written. Counts are kept
+// for the endpoints in the pool of a registered provider, so modified copies
+// (e.g. with a random port) count for their original, and custom remotes do
+// not count.
+func recordServed(selected []selectedEndpoint) {
+	if servedStore == nil {
+		return
+	}
+	keys := make([]string, 0, len(selected))
+	for _, sel := range selected {
+		name := sel.provider.Name()
+		if vpn.Providers[name] != sel.provider {
+			continue
+		}
+		keys = append(keys, endpointKey(name, sel.endpoint.PoolEndpoint()))
+	}
+	if err := servedStore.Record(keys); err != nil {
+		log.Println("ERROR:", err)
+	}
+}
+
+// leastServedEndpointPicker returns a provider selector that picks max
+// distinct endpoints, preferring the ones that have been served the least
+// number of times and, among those, the ones served least recently. Over many
+// descriptor fetches, this covers the whole pool evenly. The active rules, the
+// health policy and the optional extra filters restrict the candidates.
+func leastServedEndpointPicker(cc string, max int, extra ...namedFilter) endpointSelectorFn {
+	filters := append([]namedFilter{byCountryFilter(cc)}, extra...)
+	return func(p vpn.Provider, tr *selectionTrace) []*vpn.Endpoint {
+		if servedStore == nil {
+			log.Println("WARN: no coverage store, picking at random")
+			return filterAndRandomizeEndpointsPicker(p, filters, max, tr)
+		}
+		sel := candidateEndpoints(p, filters, tr)
+		// shuffle first, so that ties are broken at random
+		rand.Shuffle(len(sel), func(i, j int) {
+			sel[i], sel[j] = sel[j], sel[i]
+		})
+		keys := make([]string, len(sel))
+		for i, e := range sel {
+			keys[i] = endpointKey(p.Name(), e)
+		}
+		stats := servedStore.Stats(keys)
+		sort.SliceStable(sel, func(i, j int) bool {
+			si := stats[endpointKey(p.Name(), sel[i])]
+			sj := stats[endpointKey(p.Name(), sel[j])]
+			if si.Count != sj.Count {
+				return si.Count < sj.Count
+			}
+			return si.LastServed.Before(sj.LastServed)
+		})
+		// the selector can be called again, so max is not changed
+		n := max
+		if n > len(sel) {
+			n = len(sel)
+		}
+		for _, e := range sel[:n] {
+			count := stats[endpointKey(p.Name(), e)].Count
+			log.Printf("🧭 Picked endpoint %s (served %d times)\n", e.Label, count)
+			tr.draw(traceDraw{
+				Provider: p.Name(),
+				Kind:     "least-served",
+				Endpoint: traceEndpoint(e),
+				Pool:     len(sel),
+				Note:     fmt.Sprintf("served %d times", count),
+			})
+		}
+		return sel[:n]
+	}
+}
+
+// coverageStatusHandler returns the serving stats for all the endpoints of a
+// provider, including the ones that were never served.
+func coverageStatusHandler(w http.ResponseWriter, r *http.Request) {
+	providerName := getParam(paramProvider, r)
+	if !vpn.IsKnownProvider(providerName) || servedStore == nil {
+		http.Error(w, errNotFoundStr, http.StatusNotFound)
+		return
+	}
+	keys := []string{}
+	for _, e := range vpn.Providers[providerName].Endpoints() {
+		keys = append(keys, endpointKey(providerName, e))
+	}
+	json.NewEncoder(w).Encode(servedStore.Stats(keys))
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/ainghazal/torii/coverage"
+	"github.com/ainghazal/torii/share"
+	"github.com/ainghazal/torii/vpn"
+)
+
+func TestOutputFormat_write_recordServed(t *testing.T) {
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "test.db"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	saved := servedStore
+	defer func() { servedStore = saved }()
+	if servedStore, err = coverage.NewStore(db); err != nil {
+		t.Fatal(err)
+	}
+
+	pool := vpn.NewCustomProvider("test")
+	endpoint := &vpn.Endpoint{IP: "192.0.2.1", Port: "1194", Proto: "openvpn", Transport: "tcp", Obfuscation: "none"}
+	pool.AddEndpoint(endpoint)
+	vpn.Providers["test"] = pool
+	defer delete(vpn.Providers, "test")
+	custom := vpn.NewCustomProvider("test")
+	custom.AddEndpoint(&vpn.Endpoint{IP: "198.51.100.1", Port: "443", Proto: "openvpn", Transport: "tcp"})
+
+	randomPorts := withRandomPorts(randomEndpointPicker(), &share.PortPolicy{Min: 2000, Max: 2000}, pool)
+	render := func(p vpn.Provider) *config {
+		cfg, err := renderConfigForProvider(p, randomPorts, newDescriptorMeta("test", "", ""), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cfg
+	}
+	get := func(cfg *config, ifNoneMatch string, tr *selectionTrace) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if ifNoneMatch != "" {
+			r.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		formats["json"].write(w, r, cfg, nil, tr)
+		return w
+	}
+	count := func() int {
+		return servedStore.Stats([]string{endpointKey("test", endpoint)})[endpointKey("test", endpoint)].Count
+	}
+
+	cfg := render(pool)
+	w := get(cfg, "", nil)
+	if got := count(); got != 1 {
+		t.Fatalf("served count after a write = %d, want 1 under the pool endpoint", got)
+	}
+	if len(servedStore.WithPrefix("test/")) != 1 {
+		t.Errorf("the rewritten port was recorded: %v", servedStore.WithPrefix("test/"))
+	}
+
+	get(cfg, w.Header().Get("ETag"), nil)
+	get(render(pool), "", &selectionTrace{})
+	get(render(custom), "", nil)
+	if got := count(); got != 1 {
+		t.Errorf("served count = %d, want 1: 304s, explain mode or custom remotes were recorded", got)
+	}
+	if len(servedStore.WithPrefix("test/")) != 1 {
+		t.Errorf("the custom remote was recorded: %v", servedStore.WithPrefix("test/"))
+	}
+}
+
+func Test_leastServedEndpointPicker_reused(t *testing.T) {
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "test.db"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	saved := servedStore
+	defer func() { servedStore = saved }()
+	if servedStore, err = coverage.NewStore(db); err != nil {
+		t.Fatal(err)
+	}
+
+	small := vpn.NewCustomProvider("test")
+	small.AddEndpoint(&vpn.Endpoint{IP: "192.0.2.1", Port: "1194", Proto: "openvpn", Transport: "tcp"})
+	large := vpn.NewCustomProvider("test")
+	for _, ip := range []string{"192.0.2.1", "192.0.2.2", "192.0.2.3"} {
+		large.AddEndpoint(&vpn.Endpoint{IP: ip, Port: "1194", Proto: "openvpn", Transport: "tcp"})
+	}
+
+	selector := leastServedEndpointPicker("", 2)
+	if got := len(selector(small, nil)); got != 1 {
+		t.Fatalf("first call picked %d endpoints, want 1", got)
+	}
+	if got := len(selector(large, nil)); got != 2 {
+		t.Errorf("second call picked %d endpoints, want 2", got)
+	}
+}
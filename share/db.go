@@ -8,6 +8,8 @@ import (
 
 const (
 	experimentBucket = "exp"
+	revisionsBucket  = "exp-revisions"
+	ownersBucket     = "owners"
 )
 
 func InitDB() (*bolt.DB, error) {
@@ -15,15 +17,21 @@ func InitDB() (*bolt.DB, error) {
 	if err != nil {
 		return nil, err
 	}
-	err = db.Update(func(tx *bolt.Tx) error {
-		_, err := tx.CreateBucketIfNotExists([]byte(experimentBucket))
-		if err != nil {
-			return fmt.Errorf("create bucket: %s", err)
-		}
-		return nil
-	})
-	if err != nil {
+	if err := createBuckets(db); err != nil {
 		return nil, err
 	}
 	return db, nil
 }
+
+// createBuckets creates the buckets for the experiments, if needed.
+func createBuckets(db *bolt.DB) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		for _, name := range []string{experimentBucket, revisionsBucket, ownersBucket} {
+			_, err := tx.CreateBucketIfNotExists([]byte(name))
+			if err != nil {
+				return fmt.Errorf("create bucket: %s", err)
+			}
+		}
+		return nil
+	})
+}
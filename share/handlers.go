@@ -3,6 +3,7 @@ package share
 import (
 	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -18,13 +19,18 @@ import (
 
 type httpHandler func(http.ResponseWriter, *http.Request)
 
+var errBadRequest = errors.New("bad request")
+
 // randomPetname returns a two-word petname in the form "fluffy-foobar"
 func randomPetname() string {
 	petname.NonDeterministicMode()
 	return petname.Generate(2, "-")
 }
 
-func AddExperimentHandler(db *bolt.DB) httpHandler {
+// AddExperimentHandler returns a handler that stores a new experiment.
+// shareURL returns the public url of the descriptor of an experiment, which
+// is returned along with its UUID.
+func AddExperimentHandler(db *bolt.DB, shareURL func(uuid string) string) httpHandler {
 
 	return func(w http.ResponseWriter, r *http.Request) {
 		in, err := io.ReadAll(r.Body)
@@ -40,35 +46,59 @@ func AddExperimentHandler(db *bolt.DB) httpHandler {
 			http.Error(w, "bad json request", http.StatusBadRequest)
 			return
 		}
+		exp.UpdatedAt, exp.DeletedAt = nil, nil
 		if exp.Name == "" {
 			exp.Name = randomPetname()
 			log.Printf("Assigned experiment name: %s\n", exp.Name)
 		}
 
-		log.Println("exp max:", exp.Max)
+		if err := exp.Validate(); err != nil {
+			writeValidationErrors(w, err)
+			return
+		}
 
-		// TODO do validate empty fields etc
 		rawUUID := uuid.New()
 		exp.UUID = strings.Replace(rawUUID.String(), "-", "", -1)
 
-		db.Update(func(tx *bolt.Tx) error {
+		token, err := newEditToken()
+		if err != nil {
+			log.Println("ERROR:", err)
+			http.Error(w, "cannot save experiment", http.StatusInternalServerError)
+			return
+		}
+		err = db.Update(func(tx *bolt.Tx) error {
 			b := tx.Bucket([]byte(experimentBucket))
 			id, _ := b.NextSequence()
 			exp.ID = int(id)
-
-			buf, err := json.Marshal(exp)
-			if err != nil {
+			if err := putOwner(tx, exp.UUID, token); err != nil {
 				return err
 			}
-			// persist experiment in its own bucket
-			return b.Put([]byte(exp.UUID), buf)
+			return putExperiment(tx, exp)
 		})
+		if err != nil {
+			log.Println("ERROR:", err)
+			http.Error(w, "cannot save experiment", http.StatusInternalServerError)
+			return
+		}
 
-		res := &result{true, exp.UUID}
+		res := &result{OK: true, Data: exp.UUID, Token: token, URL: shareURL(exp.UUID)}
 		json.NewEncoder(w).Encode(res)
 	}
 }
 
+// writeValidationErrors writes the field errors returned by Validate, so
+// that the form can show them next to each input.
+func writeValidationErrors(w http.ResponseWriter, err error) {
+	errs, ok := err.(ValidationErrors)
+	if !ok {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(&resultErrors{false, errs})
+}
+
 func ListExperimentHandler(db *bolt.DB) httpHandler {
 
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -80,7 +110,7 @@ func ListExperimentHandler(db *bolt.DB) httpHandler {
 			b.ForEach(func(k, v []byte) error {
 				exp := new(Experiment)
 				err := json.Unmarshal(v, exp)
-				if err == nil {
+				if err == nil && !exp.Deleted() {
 					sel = append(sel, exp)
 				}
 				return err
@@ -96,35 +126,117 @@ func ListExperimentHandler(db *bolt.DB) httpHandler {
 	}
 }
 
-func GetExperimentByUUID(db *bolt.DB, uuid string) []*Experiment {
-	sel := []*Experiment{}
+// RenderJSONExperimentByUUID returns a handler that returns an experiment, or
+// the revision given with ?rev=N. A deleted experiment is returned with a 410
+// status.
+func RenderJSONExperimentByUUID(db *bolt.DB) httpHandler {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		rev, err := RevisionParam(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		exp, err := GetExperiment(db, mux.Vars(r)["uuid"], rev)
+		if err != nil {
+			writeExperimentError(w, err)
+			return
+		}
+		if exp.Deleted() {
+			w.WriteHeader(http.StatusGone)
+		}
+		res := []*resultExp{&resultExp{
+			OK:   !exp.Deleted(),
+			Data: []*Experiment{exp},
+		},
+		}
+		json.NewEncoder(w).Encode(res)
+	}
+}
+
+// UpdateExperimentHandler returns a handler that changes an experiment. PUT
+// replaces all the fields, and PATCH only the ones in the request. The result
+// is validated like a new experiment, and stored as a new revision. The
+// caller is expected to check the edit token (see CheckEditToken).
+func UpdateExperimentHandler(db *bolt.DB) httpHandler {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		in, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		exp, err := updateExperiment(db, mux.Vars(r)["uuid"], func(exp *Experiment) error {
+			name := exp.Name
+			if r.Method == http.MethodPut {
+				*exp = Experiment{}
+			}
+			if err := json.Unmarshal(in, exp); err != nil {
+				return errBadRequest
+			}
+			if exp.Name == "" {
+				exp.Name = name
+			}
+			exp.DeletedAt = nil
+			exp.PortPolicy = nil
+			return exp.Validate()
+		})
+		if err != nil {
+			writeExperimentError(w, err)
+			return
+		}
+		log.Printf("Updated experiment %s to revision %d\n", exp.UUID, exp.Revision)
+		json.NewEncoder(w).Encode(&resultExp{true, []*Experiment{exp}})
+	}
+}
 
-	db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(experimentBucket))
-		v := b.Get([]byte(uuid))
+// DeleteExperimentHandler returns a handler that deletes an experiment. The
+// experiment is kept as a tombstone, so that shared links can tell that it's
+// gone. The caller is expected to check the edit token.
+func DeleteExperimentHandler(db *bolt.DB) httpHandler {
 
-		exp := new(Experiment)
-		err := json.Unmarshal(v, exp)
-		if err == nil {
-			sel = append(sel, exp)
+	return func(w http.ResponseWriter, r *http.Request) {
+		exp, err := deleteExperiment(db, mux.Vars(r)["uuid"])
+		if err != nil {
+			writeExperimentError(w, err)
+			return
 		}
-		return err
-	})
-	return sel
+		log.Printf("Deleted experiment %s\n", exp.UUID)
+		json.NewEncoder(w).Encode(&result{OK: true, Data: exp.UUID})
+	}
 }
 
-func RenderJSONExperimentByUUID(db *bolt.DB) httpHandler {
+// ListRevisionsHandler returns a handler that lists all the revisions of an
+// experiment, oldest first.
+func ListRevisionsHandler(db *bolt.DB) httpHandler {
 
 	return func(w http.ResponseWriter, r *http.Request) {
-		uuid := mux.Vars(r)["uuid"]
-		sel := GetExperimentByUUID(db, uuid)
+		sel, err := ListRevisions(db, mux.Vars(r)["uuid"])
+		if err != nil {
+			writeExperimentError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(&resultExp{true, sel})
+	}
+}
 
-		res := []*resultExp{&resultExp{
-			OK:   true,
-			Data: sel,
-		},
+// writeExperimentError writes an error returned when looking up or changing
+// an experiment, with the matching status.
+func writeExperimentError(w http.ResponseWriter, err error) {
+	switch {
+	case IsNotFound(err):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case IsDeleted(err):
+		http.Error(w, err.Error(), http.StatusGone)
+	case errors.Is(err, errBadRequest):
+		http.Error(w, "bad json request", http.StatusBadRequest)
+	default:
+		if _, ok := err.(ValidationErrors); ok {
+			writeValidationErrors(w, err)
+			return
 		}
-		json.NewEncoder(w).Encode(res)
+		log.Println("ERROR:", err)
+		http.Error(w, "cannot save experiment", http.StatusInternalServerError)
 	}
 }
 
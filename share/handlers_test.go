@@ -0,0 +1,50 @@
+package share
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAddExperimentHandler(t *testing.T) {
+	db := newTestDB(t)
+	handler := AddExperimentHandler(db, func(uuid string) string { return "https://example.org/share/" + uuid })
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantPolicy *PortPolicy
+	}{
+		{"inverted port policy", `{"provider":"riseup","port_policy":{"min":5,"max":1}}`, http.StatusBadRequest, nil},
+		{"port policy out of bounds", `{"provider":"riseup","randomPort":"on","port_policy":{"ports":[70000]}}`, http.StatusBadRequest, nil},
+		{"port policy without random ports", `{"provider":"riseup","port_policy":{"min":1,"max":5}}`, http.StatusOK, nil},
+		{"port policy from the ports field", `{"provider":"riseup","randomPort":"on","ports":"80-81","port_policy":{"min":1,"max":5}}`, http.StatusOK, &PortPolicy{Min: 80, Max: 81}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler(w, httptest.NewRequest(http.MethodPost, "/api/experiment/add", strings.NewReader(tt.body)))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			res := &result{}
+			if err := json.NewDecoder(w.Body).Decode(res); err != nil {
+				t.Fatal(err)
+			}
+			exp, err := GetExperiment(db, res.Data, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(exp.PortPolicy, tt.wantPolicy) {
+				t.Errorf("stored port policy = %+v, want %+v", exp.PortPolicy, tt.wantPolicy)
+			}
+		})
+	}
+}
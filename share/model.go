@@ -1,19 +1,53 @@
 package share
 
+import "time"
+
 type Experiment struct {
-	ID             int    `json:"ID"`
-	Name           string `json:"name"`
-	Provider       string `json:"provider"`
-	CountryCode    string `json:"cc"`
-	Comment        string `json:"comment"`
-	Max            string `json:"max"`
+	ID          int    `json:"ID"`
+	Name        string `json:"name"`
+	Provider    string `json:"provider"`
+	CountryCode string `json:"cc"`
+	Comment     string `json:"comment"`
+	Max         string `json:"max"`
+	// Strategy is the name of the selection strategy, see /vpn/strategies.
+	Strategy string `json:"strategy"`
+	// Variants are the variants of the paired strategy, e.g. "tcp,udp".
+	Variants       string `json:"variants"`
 	EndpointRemote string `json:"endpoint_remote"`
-	UUID           string
+	// Mix draws endpoints from several providers, e.g. "riseup:2,tunnelbear:1".
+	Mix        string `json:"mix"`
+	RandomPort string `json:"randomPort"`
+	Ports      string `json:"ports"`
+	// PortPolicy is set when the experiment asks for random ports.
+	PortPolicy *PortPolicy `json:"port_policy,omitempty"`
+	// DescriptorName, DescriptorDescription and DescriptorAuthor override
+	// the metadata templates in the config, if set.
+	DescriptorName        string `json:"descriptor_name,omitempty"`
+	DescriptorDescription string `json:"descriptor_description,omitempty"`
+	DescriptorAuthor      string `json:"descriptor_author,omitempty"`
+	// Credentials is "token" for secret-free descriptors.
+	Credentials string `json:"credentials,omitempty"`
+	UUID        string
+	// Revision is the number of the stored revision, see revisions.go.
+	Revision  int        `json:"revision,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+	// DeletedAt is set in the tombstone of a deleted experiment.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
 }
 
 type result struct {
 	OK   bool   `json:"ok"`
 	Data string `json:"data"`
+	// Token is the edit token of a new experiment. It's only returned
+	// once, when the experiment is created.
+	Token string `json:"token,omitempty"`
+	// URL is the public url of the descriptor of a new experiment.
+	URL string `json:"url,omitempty"`
+}
+
+type resultErrors struct {
+	OK     bool             `json:"ok"`
+	Errors ValidationErrors `json:"errors"`
 }
 
 type resultExp struct {
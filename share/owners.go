@@ -0,0 +1,78 @@
+package share
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const editTokenBytes = 32
+
+var errForbidden = errors.New("forbidden")
+
+// IsForbidden returns true if the error means that the token cannot edit the
+// experiment.
+func IsForbidden(err error) bool {
+	return errors.Is(err, errForbidden)
+}
+
+// owner is stored in the owners bucket, keyed by the UUID of an experiment.
+// Only the hash of the edit token is kept. Experiments created before edit
+// tokens existed have no owner, and only the admin can change them.
+type owner struct {
+	TokenHash string    `json:"token_hash"`
+	Created   time.Time `json:"created"`
+}
+
+// newEditToken returns a new random edit token.
+func newEditToken() (string, error) {
+	raw := make([]byte, editTokenBytes)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(raw), nil
+}
+
+func hashEditToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// putOwner stores the hash of the edit token of an experiment.
+func putOwner(tx *bolt.Tx, uuid, token string) error {
+	buf, err := json.Marshal(&owner{
+		TokenHash: hashEditToken(token),
+		Created:   time.Now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+	return tx.Bucket([]byte(ownersBucket)).Put([]byte(uuid), buf)
+}
+
+// CheckEditToken returns nil if token is the edit token of the experiment.
+func CheckEditToken(db *bolt.DB, uuid, token string) error {
+	return db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte(experimentBucket)).Get([]byte(uuid)) == nil {
+			return errNotFound
+		}
+		v := tx.Bucket([]byte(ownersBucket)).Get([]byte(uuid))
+		if v == nil || token == "" {
+			return errForbidden
+		}
+		o := &owner{}
+		if err := json.Unmarshal(v, o); err != nil {
+			return err
+		}
+		if subtle.ConstantTimeCompare([]byte(hashEditToken(token)), []byte(o.TokenHash)) != 1 {
+			return errForbidden
+		}
+		return nil
+	})
+}
@@ -0,0 +1,46 @@
+package share
+
+import (
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestCheckEditToken(t *testing.T) {
+	db := newTestDB(t)
+
+	token, err := newEditToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Update(func(tx *bolt.Tx) error {
+		if err := putOwner(tx, "owned", token); err != nil {
+			return err
+		}
+		if err := putExperiment(tx, &Experiment{UUID: "owned"}); err != nil {
+			return err
+		}
+		return putExperiment(tx, &Experiment{UUID: "legacy"})
+	})
+
+	tests := []struct {
+		name  string
+		uuid  string
+		token string
+		check func(error) bool
+	}{
+		{"edit token", "owned", token, func(err error) bool { return err == nil }},
+		{"wrong token", "owned", token[1:], IsForbidden},
+		{"no token", "owned", "", IsForbidden},
+		{"token hash", "owned", hashEditToken(token), IsForbidden},
+		{"no owner", "legacy", token, IsForbidden},
+		{"no experiment", "nope", token, IsNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := CheckEditToken(db, tt.uuid, tt.token); !tt.check(err) {
+				t.Errorf("CheckEditToken() err = %v", err)
+			}
+		})
+	}
+}
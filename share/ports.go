@@ -0,0 +1,118 @@
+package share
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+var errBadPortPolicy = errors.New("bad port policy")
+
+// PortPolicy describes how to pick random ports for the endpoints of an
+// experiment: either from an inclusive range, or from a set of ports. A
+// policy with neither a range nor a set means "any port that the provider is
+// known to accept".
+type PortPolicy struct {
+	Min   int   `json:"min,omitempty"`
+	Max   int   `json:"max,omitempty"`
+	Ports []int `json:"ports,omitempty"`
+}
+
+// ParsePortPolicy parses a port policy in the form "1000-2000" (range) or
+// "80,443,1194" (set). An empty string returns a policy that uses the
+// provider's known ports.
+func ParsePortPolicy(s string) (*PortPolicy, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return &PortPolicy{}, nil
+	}
+	if lo, hi, ok := strings.Cut(s, "-"); ok {
+		min, err := parsePort(lo)
+		if err != nil {
+			return nil, err
+		}
+		max, err := parsePort(hi)
+		if err != nil {
+			return nil, err
+		}
+		if min > max {
+			return nil, fmt.Errorf("%w: empty range %s", errBadPortPolicy, s)
+		}
+		return &PortPolicy{Min: min, Max: max}, nil
+	}
+	policy := &PortPolicy{}
+	for _, p := range strings.Split(s, ",") {
+		port, err := parsePort(p)
+		if err != nil {
+			return nil, err
+		}
+		policy.Ports = append(policy.Ports, port)
+	}
+	return policy, nil
+}
+
+// Validate checks the bounds of a policy that ParsePortPolicy did not build,
+// e.g. one read back from the database.
+func (pp *PortPolicy) Validate() error {
+	if pp.Min != 0 || pp.Max != 0 {
+		if pp.Min < 1 || pp.Max > 65535 || pp.Min > pp.Max {
+			return fmt.Errorf("%w: bad range %d-%d", errBadPortPolicy, pp.Min, pp.Max)
+		}
+	}
+	for _, port := range pp.Ports {
+		if port < 1 || port > 65535 {
+			return fmt.Errorf("%w: invalid port %d", errBadPortPolicy, port)
+		}
+	}
+	return nil
+}
+
+func parsePort(s string) (int, error) {
+	port, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || port < 1 || port > 65535 {
+		return 0, fmt.Errorf("%w: invalid port %q", errBadPortPolicy, s)
+	}
+	return port, nil
+}
+
+// Pick returns a random port according to the policy. known is the list of
+// ports the provider is known to accept, used when the policy has no range
+// or set. Only ports for which allowed returns true are picked, if allowed is
+// not nil. It returns false if there is nothing to pick from, or if the
+// policy is not valid.
+func (pp *PortPolicy) Pick(known []int, allowed func(int) bool) (int, bool) {
+	if pp.Validate() != nil {
+		return 0, false
+	}
+	if allowed == nil {
+		allowed = func(int) bool { return true }
+	}
+	if pp.Max > 0 {
+		// scan the range from a random offset, so that denied ports do not
+		// need retries
+		n := pp.Max - pp.Min + 1
+		start := rand.Intn(n)
+		for i := 0; i < n; i++ {
+			if port := pp.Min + (start+i)%n; allowed(port) {
+				return port, true
+			}
+		}
+		return 0, false
+	}
+	ports := pp.Ports
+	if len(ports) == 0 {
+		ports = known
+	}
+	candidates := []int{}
+	for _, port := range ports {
+		if allowed(port) {
+			candidates = append(candidates, port)
+		}
+	}
+	if len(candidates) == 0 {
+		return 0, false
+	}
+	return candidates[rand.Intn(len(candidates))], true
+}
@@ -0,0 +1,89 @@
+package share
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParsePortPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		arg     string
+		want    *PortPolicy
+		wantErr error
+	}{
+		{
+			name: "empty means known ports",
+			arg:  "",
+			want: &PortPolicy{},
+		},
+		{
+			name: "range",
+			arg:  "1000-2000",
+			want: &PortPolicy{Min: 1000, Max: 2000},
+		},
+		{
+			name: "set",
+			arg:  "80, 443,1194",
+			want: &PortPolicy{Ports: []int{80, 443, 1194}},
+		},
+		{
+			name:    "inverted range",
+			arg:     "2000-1000",
+			wantErr: errBadPortPolicy,
+		},
+		{
+			name:    "out of bounds",
+			arg:     "0-70000",
+			wantErr: errBadPortPolicy,
+		},
+		{
+			name:    "garbage",
+			arg:     "80,http",
+			wantErr: errBadPortPolicy,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParsePortPolicy(tt.arg)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("ParsePortPolicy() err = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParsePortPolicy() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPortPolicy_Pick(t *testing.T) {
+	pp := &PortPolicy{Min: 10, Max: 12}
+	for i := 0; i < 100; i++ {
+		if got, _ := pp.Pick(nil, nil); got < 10 || got > 12 {
+			t.Fatalf("Pick() = %v, out of range", got)
+		}
+	}
+	if _, ok := (&PortPolicy{}).Pick(nil, nil); ok {
+		t.Errorf("Pick() with nothing to pick from should fail")
+	}
+	if got, _ := (&PortPolicy{}).Pick([]int{443}, nil); got != 443 {
+		t.Errorf("Pick() = %v, want 443", got)
+	}
+	for _, pp := range []*PortPolicy{{Min: 5, Max: 1}, {Min: 0, Max: 10}, {Min: 1, Max: 70000}, {Ports: []int{443, -1}}} {
+		if got, ok := pp.Pick([]int{443}, nil); ok {
+			t.Errorf("Pick() with %+v = %v, want nothing", pp, got)
+		}
+	}
+	not53 := func(port int) bool { return port != 53 }
+	for _, pp := range []*PortPolicy{{Min: 52, Max: 54}, {Ports: []int{53, 443}}, {}} {
+		for i := 0; i < 100; i++ {
+			if got, ok := pp.Pick([]int{53, 1194}, not53); !ok || got == 53 {
+				t.Fatalf("Pick() = %v, %v, picked a port that is not allowed", got, ok)
+			}
+		}
+	}
+	if _, ok := (&PortPolicy{Ports: []int{53}}).Pick(nil, not53); ok {
+		t.Errorf("Pick() with only denied ports should fail")
+	}
+}
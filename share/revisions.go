@@ -0,0 +1,168 @@
+package share
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// ParamRevision is the query parameter to ask for a given revision.
+const ParamRevision = "rev"
+
+var (
+	errNotFound = errors.New("experiment not found")
+	errDeleted  = errors.New("experiment deleted")
+)
+
+// IsNotFound returns true if the error means that there's no such experiment
+// or revision.
+func IsNotFound(err error) bool {
+	return errors.Is(err, errNotFound)
+}
+
+// IsDeleted returns true if the error means that the experiment was deleted.
+func IsDeleted(err error) bool {
+	return errors.Is(err, errDeleted)
+}
+
+// Deleted returns true if the experiment is a tombstone.
+func (exp *Experiment) Deleted() bool {
+	return exp.DeletedAt != nil
+}
+
+// RevisionParam returns the revision asked for in the query string, or 0 for
+// the current one.
+func RevisionParam(r *http.Request) (int, error) {
+	s := r.URL.Query().Get(ParamRevision)
+	if s == "" {
+		return 0, nil
+	}
+	rev, err := strconv.Atoi(s)
+	if err != nil || rev < 1 {
+		return 0, fmt.Errorf("bad revision: %q", s)
+	}
+	return rev, nil
+}
+
+// GetExperiment returns the given revision of an experiment, or the current
+// one if rev is 0. Deleted experiments are returned too, check Deleted.
+func GetExperiment(db *bolt.DB, uuid string, rev int) (*Experiment, error) {
+	exp := &Experiment{}
+	err := db.View(func(tx *bolt.Tx) error {
+		var v []byte
+		if rev == 0 {
+			v = tx.Bucket([]byte(experimentBucket)).Get([]byte(uuid))
+		} else if revs := tx.Bucket([]byte(revisionsBucket)).Bucket([]byte(uuid)); revs != nil {
+			v = revs.Get(itob(rev))
+		}
+		if v == nil {
+			return errNotFound
+		}
+		return json.Unmarshal(v, exp)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return exp, nil
+}
+
+// ListRevisions returns all the revisions of an experiment, oldest first.
+func ListRevisions(db *bolt.DB, uuid string) ([]*Experiment, error) {
+	sel := []*Experiment{}
+	err := db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte(experimentBucket)).Get([]byte(uuid)) == nil {
+			return errNotFound
+		}
+		revs := tx.Bucket([]byte(revisionsBucket)).Bucket([]byte(uuid))
+		if revs == nil {
+			return nil
+		}
+		return revs.ForEach(func(k, v []byte) error {
+			exp := new(Experiment)
+			if err := json.Unmarshal(v, exp); err != nil {
+				return err
+			}
+			sel = append(sel, exp)
+			return nil
+		})
+	})
+	return sel, err
+}
+
+// putExperiment stores the experiment as a new revision, in the bucket of the
+// experiment in the revisions bucket, and as the current version in the
+// experiment bucket. Experiments created before revisions existed have
+// revision 0 until their first change.
+func putExperiment(tx *bolt.Tx, exp *Experiment) error {
+	revs, err := tx.Bucket([]byte(revisionsBucket)).CreateBucketIfNotExists([]byte(exp.UUID))
+	if err != nil {
+		return err
+	}
+	id, err := revs.NextSequence()
+	if err != nil {
+		return err
+	}
+	exp.Revision = int(id)
+	buf, err := json.Marshal(exp)
+	if err != nil {
+		return err
+	}
+	if err := revs.Put(itob(exp.Revision), buf); err != nil {
+		return err
+	}
+	return tx.Bucket([]byte(experimentBucket)).Put([]byte(exp.UUID), buf)
+}
+
+// updateExperiment applies change to the current version of an experiment,
+// and stores the result as a new revision. Deleted experiments cannot be
+// changed. If change returns an error, nothing is stored. The ID and the UUID
+// of the experiment are kept whatever change does.
+func updateExperiment(db *bolt.DB, uuid string, change func(*Experiment) error) (*Experiment, error) {
+	var exp *Experiment
+	err := db.Update(func(tx *bolt.Tx) error {
+		v := tx.Bucket([]byte(experimentBucket)).Get([]byte(uuid))
+		if v == nil {
+			return errNotFound
+		}
+		old := &Experiment{}
+		if err := json.Unmarshal(v, old); err != nil {
+			return err
+		}
+		if old.Deleted() {
+			return errDeleted
+		}
+		if old.Revision == 0 {
+			// keep the original of an experiment from before revisions
+			if err := putExperiment(tx, old); err != nil {
+				return err
+			}
+		}
+		exp = &Experiment{}
+		*exp = *old
+		if err := change(exp); err != nil {
+			return err
+		}
+		exp.ID, exp.UUID = old.ID, old.UUID
+		now := time.Now().UTC()
+		exp.UpdatedAt = &now
+		return putExperiment(tx, exp)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return exp, nil
+}
+
+// deleteExperiment stores a tombstone as the last revision of an experiment.
+func deleteExperiment(db *bolt.DB, uuid string) (*Experiment, error) {
+	return updateExperiment(db, uuid, func(exp *Experiment) error {
+		now := time.Now().UTC()
+		exp.DeletedAt = &now
+		return nil
+	})
+}
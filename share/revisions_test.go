@@ -0,0 +1,76 @@
+package share
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func newTestDB(t *testing.T) *bolt.DB {
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "test.db"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := createBuckets(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestUpdateExperiment(t *testing.T) {
+	db := newTestDB(t)
+
+	// an experiment stored before revisions existed
+	legacy, _ := json.Marshal(&Experiment{ID: 1, UUID: "abc", Name: "typo", Provider: "riseup"})
+	db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(experimentBucket)).Put([]byte("abc"), legacy)
+	})
+
+	exp, err := updateExperiment(db, "abc", func(exp *Experiment) error {
+		exp.Name = "fixed"
+		exp.UUID = "other"
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp.Revision != 2 || exp.UUID != "abc" || exp.ID != 1 {
+		t.Errorf("updateExperiment() = rev %d, uuid %s, id %d, want 2, abc, 1", exp.Revision, exp.UUID, exp.ID)
+	}
+	if _, err := updateExperiment(db, "abc", func(exp *Experiment) error {
+		exp.Name = "invalid"
+		return ValidationErrors{{"name", "bad"}}
+	}); err == nil {
+		t.Errorf("updateExperiment() should fail when change fails")
+	}
+
+	if _, err := deleteExperiment(db, "abc"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := updateExperiment(db, "abc", func(*Experiment) error { return nil }); !IsDeleted(err) {
+		t.Errorf("updateExperiment() on a tombstone, err = %v", err)
+	}
+	if _, err := updateExperiment(db, "nope", func(*Experiment) error { return nil }); !IsNotFound(err) {
+		t.Errorf("updateExperiment() on an unknown experiment, err = %v", err)
+	}
+
+	current, err := GetExperiment(db, "abc", 0)
+	if err != nil || !current.Deleted() || current.Revision != 3 {
+		t.Fatalf("GetExperiment() = %+v, %v, want the tombstone", current, err)
+	}
+	for rev, name := range map[int]string{1: "typo", 2: "fixed"} {
+		exp, err := GetExperiment(db, "abc", rev)
+		if err != nil || exp.Name != name || exp.Deleted() {
+			t.Errorf("GetExperiment(rev %d) = %+v, %v, want %s", rev, exp, err, name)
+		}
+	}
+	if _, err := GetExperiment(db, "abc", 4); !IsNotFound(err) {
+		t.Errorf("GetExperiment(rev 4), err = %v", err)
+	}
+	if revs, _ := ListRevisions(db, "abc"); len(revs) != 3 {
+		t.Errorf("ListRevisions() returned %d revisions, want 3", len(revs))
+	}
+}
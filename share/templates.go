@@ -0,0 +1,19 @@
+package share
+
+import (
+	"strings"
+	"text/template"
+)
+
+// TemplateFuncs are the functions available to the descriptor metadata
+// templates.
+var TemplateFuncs = template.FuncMap{
+	"join":  strings.Join,
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+}
+
+// ParseTemplate parses a descriptor metadata template.
+func ParseTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).Funcs(TemplateFuncs).Option("missingkey=error").Parse(text)
+}
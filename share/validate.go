@@ -0,0 +1,190 @@
+package share
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/ainghazal/torii/vpn"
+)
+
+// MaxEndpoints is the largest number of endpoints an experiment can ask for.
+const MaxEndpoints = 100
+
+// KnownStrategy returns true if a selection strategy is registered. The
+// strategies live with the server, which sets it; if nil, any strategy is
+// accepted.
+var KnownStrategy func(name string) bool
+
+// FieldError is a validation error for one field of an experiment. Field is
+// the json name of the field, which is also the name of the form input.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationErrors are all the problems found in an experiment.
+type ValidationErrors []FieldError
+
+func (v ValidationErrors) Error() string {
+	msgs := []string{}
+	for _, e := range v {
+		msgs = append(msgs, e.Field+": "+e.Message)
+	}
+	return "invalid experiment: " + strings.Join(msgs, "; ")
+}
+
+func (v *ValidationErrors) add(field, format string, a ...any) {
+	*v = append(*v, FieldError{field, fmt.Sprintf(format, a...)})
+}
+
+// Validate checks the fields of an experiment, and returns nil if all of them
+// are valid. A port policy sent as is must be valid too, but it's replaced
+// by the one parsed from the ports field, if the experiment asks for random
+// ports, and dropped otherwise.
+func (exp *Experiment) Validate() error {
+	errs := ValidationErrors{}
+
+	switch {
+	case exp.Mix != "":
+		// the provider is not used
+	case exp.Provider == "":
+		errs.add("provider", "a provider is required")
+	case exp.Provider == "unknown":
+		if exp.EndpointRemote == "" {
+			errs.add("provider", "an unknown provider needs a remote")
+		}
+	case !vpn.IsKnownProvider(exp.Provider):
+		errs.add("provider", "unknown provider: %q", exp.Provider)
+	}
+
+	if exp.Mix != "" {
+		if _, err := ParseMix(exp.Mix); err != nil {
+			errs.add("mix", "%v", err)
+		}
+	}
+
+	if exp.Strategy != "" && KnownStrategy != nil && !KnownStrategy(exp.Strategy) {
+		errs.add("strategy", "unknown strategy: %q", exp.Strategy)
+	}
+
+	if exp.CountryCode != "" && exp.CountryCode != "any" && !IsCountryCode(exp.CountryCode) {
+		errs.add("cc", "not an ISO 3166-1 alpha-2 country code: %q", exp.CountryCode)
+	}
+
+	if exp.EndpointRemote != "" {
+		if err := checkRemote(exp.EndpointRemote); err != nil {
+			errs.add("endpoint_remote", "%v", err)
+		}
+	}
+
+	if exp.Max != "" {
+		max, err := strconv.Atoi(exp.Max)
+		if err != nil || max < 1 || max > MaxEndpoints {
+			errs.add("max", "must be a number between 1 and %d", MaxEndpoints)
+		}
+	}
+
+	if exp.PortPolicy != nil {
+		if err := exp.PortPolicy.Validate(); err != nil {
+			errs.add("port_policy", "%v", err)
+		}
+	}
+	// the policy is always built from the ports field, and only kept with
+	// random ports
+	exp.PortPolicy = nil
+	if exp.RandomPort != "" {
+		var err error
+		if exp.PortPolicy, err = ParsePortPolicy(exp.Ports); err != nil {
+			errs.add("ports", "%v", err)
+		}
+	}
+
+	for _, tmpl := range []struct{ field, text string }{
+		{"descriptor_name", exp.DescriptorName},
+		{"descriptor_description", exp.DescriptorDescription},
+		{"descriptor_author", exp.DescriptorAuthor},
+	} {
+		if _, err := ParseTemplate(tmpl.field, tmpl.text); err != nil {
+			errs.add(tmpl.field, "%v", err)
+		}
+	}
+
+	if exp.Credentials != "" && exp.Credentials != "token" {
+		errs.add("credentials", "unknown credentials mode: %q", exp.Credentials)
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// MixEntry is the number of endpoints to draw from a provider in a mixed
+// descriptor.
+type MixEntry struct {
+	Provider string
+	Count    int
+}
+
+// ParseMix parses a list of providers in the form "riseup:2,tunnelbear:1". A
+// missing count means one endpoint. The counts add up to MaxEndpoints at most.
+func ParseMix(s string) ([]MixEntry, error) {
+	mix := []MixEntry{}
+	total := 0
+	for _, item := range strings.Split(s, ",") {
+		name, count, _ := strings.Cut(strings.TrimSpace(item), ":")
+		if !vpn.IsKnownProvider(name) {
+			return nil, fmt.Errorf("unknown provider: %q", name)
+		}
+		n := 1
+		if count != "" {
+			var err error
+			n, err = strconv.Atoi(count)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("bad count for %s: %q", name, count)
+			}
+		}
+		if total += n; total > MaxEndpoints {
+			return nil, fmt.Errorf("more than %d endpoints in total", MaxEndpoints)
+		}
+		mix = append(mix, MixEntry{name, n})
+	}
+	return mix, nil
+}
+
+// checkRemote checks a remote in the form host:port, where host is an IP
+// address or a hostname. IPv6 addresses go in brackets, e.g. [2001:db8::1]:443.
+func checkRemote(remote string) error {
+	host, port, err := net.SplitHostPort(remote)
+	if err != nil {
+		return fmt.Errorf("expected host:port, got %q", remote)
+	}
+	if net.ParseIP(host) == nil && !isHostname(host) {
+		return fmt.Errorf("not an IP address or hostname: %q", host)
+	}
+	if p, err := strconv.Atoi(port); err != nil || p < 1 || p > 65535 {
+		return fmt.Errorf("invalid port: %q", port)
+	}
+	return nil
+}
+
+// isHostname returns true if s is a valid DNS hostname (RFC 1123).
+func isHostname(s string) bool {
+	s = strings.TrimSuffix(s, ".")
+	if s == "" || len(s) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(s, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,153 @@
+package share
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExperiment_Validate(t *testing.T) {
+	saved := KnownStrategy
+	defer func() { KnownStrategy = saved }()
+	KnownStrategy = func(name string) bool { return name == "uniform" }
+
+	tests := []struct {
+		name string
+		exp  Experiment
+		want []string // the fields with errors
+	}{
+		{
+			name: "known provider",
+			exp:  Experiment{Provider: "riseup", CountryCode: "any", Max: "10"},
+		},
+		{
+			name: "unknown provider",
+			exp:  Experiment{Provider: "nordvpn"},
+			want: []string{"provider"},
+		},
+		{
+			name: "missing provider",
+			exp:  Experiment{},
+			want: []string{"provider"},
+		},
+		{
+			name: "unknown provider with a remote",
+			exp:  Experiment{Provider: "unknown", EndpointRemote: "1.1.1.1:443"},
+		},
+		{
+			name: "unknown provider without a remote",
+			exp:  Experiment{Provider: "unknown"},
+			want: []string{"provider"},
+		},
+		{
+			name: "mix ignores the provider",
+			exp:  Experiment{Provider: "nordvpn", Mix: "riseup:2,tunnelbear"},
+		},
+		{
+			name: "bad mix",
+			exp:  Experiment{Mix: "riseup:0"},
+			want: []string{"mix"},
+		},
+		{
+			name: "country code",
+			exp:  Experiment{Provider: "riseup", CountryCode: "NL"},
+		},
+		{
+			name: "unassigned country code",
+			exp:  Experiment{Provider: "riseup", CountryCode: "xx"},
+			want: []string{"cc"},
+		},
+		{
+			name: "remote without port",
+			exp:  Experiment{Provider: "riseup", EndpointRemote: "1.1.1.1"},
+			want: []string{"endpoint_remote"},
+		},
+		{
+			name: "ipv6 remote",
+			exp:  Experiment{Provider: "riseup", EndpointRemote: "[2001:db8::1]:1194"},
+		},
+		{
+			name: "unbracketed ipv6 remote",
+			exp:  Experiment{Provider: "riseup", EndpointRemote: "2001:db8::1:1194"},
+			want: []string{"endpoint_remote"},
+		},
+		{
+			name: "hostname remote",
+			exp:  Experiment{Provider: "riseup", EndpointRemote: "vpn.example.org:443"},
+		},
+		{
+			name: "bad remote host and port",
+			exp:  Experiment{Provider: "riseup", EndpointRemote: "-bad_host:70000"},
+			want: []string{"endpoint_remote"},
+		},
+		{
+			name: "max out of bounds",
+			exp:  Experiment{Provider: "riseup", Max: "1000"},
+			want: []string{"max"},
+		},
+		{
+			name: "max not a number",
+			exp:  Experiment{Provider: "riseup", Max: "ten"},
+			want: []string{"max"},
+		},
+		{
+			name: "known strategy",
+			exp:  Experiment{Provider: "riseup", Strategy: "uniform"},
+		},
+		{
+			name: "unknown strategy",
+			exp:  Experiment{Provider: "riseup", Strategy: "fastest"},
+			want: []string{"strategy"},
+		},
+		{
+			name: "bad ports and template",
+			exp:  Experiment{Provider: "riseup", RandomPort: "on", Ports: "80-", DescriptorName: "{{.Provider"},
+			want: []string{"ports", "descriptor_name"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []string{}
+			if err := tt.exp.Validate(); err != nil {
+				for _, e := range err.(ValidationErrors) {
+					got = append(got, e.Field)
+				}
+			}
+			if tt.want == nil {
+				tt.want = []string{}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Validate() fields = %v, want %v (%v)", got, tt.want, tt.exp.Validate())
+			}
+		})
+	}
+}
+
+func TestParseMix(t *testing.T) {
+	tests := []struct {
+		name    string
+		arg     string
+		want    []MixEntry
+		wantErr bool
+	}{
+		{
+			name: "counts",
+			arg:  "riseup:2, tunnelbear",
+			want: []MixEntry{{"riseup", 2}, {"tunnelbear", 1}},
+		},
+		{name: "unknown provider", arg: "riseup:1,nordvpn:1", wantErr: true},
+		{name: "zero count", arg: "riseup:0", wantErr: true},
+		{name: "huge count", arg: "riseup:99999999", wantErr: true},
+		{name: "total above the limit", arg: "riseup:60,tunnelbear:41", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseMix(tt.arg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseMix() err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseMix() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+// Package sign signs descriptors with Ed25519, as detached JSON Web
+// Signatures (RFC 7515, appendix F), and publishes the public key as a JSON
+// Web Key (RFC 8037).
+package sign
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"os"
+	"strings"
+)
+
+const algEdDSA = "EdDSA"
+
+var (
+	errBadKey       = errors.New("sign: not an ed25519 private key")
+	errBadJWK       = errors.New("sign: not an ed25519 jwk")
+	errBadSignature = errors.New("sign: bad signature")
+)
+
+var b64 = base64.RawURLEncoding
+
+// JWK is the public part of a signing key.
+type JWK struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Signer signs payloads with a private key.
+type Signer struct {
+	key ed25519.PrivateKey
+	jwk JWK
+}
+
+// NewSigner returns a signer for the passed private key.
+func NewSigner(key ed25519.PrivateKey) *Signer {
+	pub := key.Public().(ed25519.PublicKey)
+	jwk := JWK{
+		Kty: "OKP",
+		Crv: "Ed25519",
+		X:   b64.EncodeToString(pub),
+		Alg: algEdDSA,
+		Use: "sig",
+	}
+	jwk.Kid = thumbprint(jwk)
+	return &Signer{key: key, jwk: jwk}
+}
+
+// LoadSigner reads a PKCS #8 PEM private key, as written by
+// "openssl genpkey -algorithm ed25519".
+func LoadSigner(path string) (*Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errBadKey
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	edKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errBadKey
+	}
+	return NewSigner(edKey), nil
+}
+
+// JWK returns the public key of the signer.
+func (s *Signer) JWK() JWK {
+	return s.jwk
+}
+
+// Sign returns a detached JWS for the payload, in the compact form with an
+// empty payload part ("header..signature").
+func (s *Signer) Sign(payload []byte) string {
+	h, _ := json.Marshal(header{Alg: algEdDSA, Kid: s.jwk.Kid})
+	protected := b64.EncodeToString(h)
+	sig := ed25519.Sign(s.key, signingInput(protected, payload))
+	return protected + ".." + b64.EncodeToString(sig)
+}
+
+// Verify checks a detached JWS for the payload against a public key.
+func Verify(jwk JWK, payload []byte, jws string) error {
+	if jwk.Kty != "OKP" || jwk.Crv != "Ed25519" {
+		return errBadJWK
+	}
+	pub, err := b64.DecodeString(jwk.X)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return errBadJWK
+	}
+	parts := strings.Split(jws, ".")
+	if len(parts) != 3 || parts[1] != "" {
+		return errBadSignature
+	}
+	h, err := b64.DecodeString(parts[0])
+	if err != nil {
+		return errBadSignature
+	}
+	var hdr header
+	if err := json.Unmarshal(h, &hdr); err != nil || hdr.Alg != algEdDSA {
+		return errBadSignature
+	}
+	if jwk.Kid != "" && hdr.Kid != jwk.Kid {
+		return errBadSignature
+	}
+	sig, err := b64.DecodeString(parts[2])
+	if err != nil {
+		return errBadSignature
+	}
+	if !ed25519.Verify(pub, signingInput(parts[0], payload), sig) {
+		return errBadSignature
+	}
+	return nil
+}
+
+func signingInput(protected string, payload []byte) []byte {
+	return []byte(protected + "." + b64.EncodeToString(payload))
+}
+
+// thumbprint returns the RFC 7638 thumbprint of the key, which we use as the
+// key id.
+func thumbprint(jwk JWK) string {
+	// the required members, in lexicographic order
+	canonical := `{"crv":"` + jwk.Crv + `","kty":"` + jwk.Kty + `","x":"` + jwk.X + `"}`
+	sum := sha256.Sum256([]byte(canonical))
+	return b64.EncodeToString(sum[:])
+}
@@ -0,0 +1,35 @@
+package sign
+
+import (
+	"crypto/ed25519"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	s := NewSigner(ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize)))
+	other := NewSigner(ed25519.NewKeyFromSeed([]byte("01234567890123456789012345678901")))
+	payload := []byte(`{"name":"openvpn-riseup"}`)
+	jws := s.Sign(payload)
+
+	tests := []struct {
+		name    string
+		jwk     JWK
+		payload []byte
+		jws     string
+		wantErr bool
+	}{
+		{"valid", s.JWK(), payload, jws, false},
+		{"tampered payload", s.JWK(), []byte(`{"name":"openvpn-other"}`), jws, true},
+		{"other key", other.JWK(), payload, jws, true},
+		{"attached payload", s.JWK(), payload, "a.b.c", true},
+		{"garbage", s.JWK(), payload, "garbage", true},
+		{"bad jwk", JWK{Kty: "RSA"}, payload, jws, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Verify(tt.jwk, tt.payload, tt.jws); (err != nil) != tt.wantErr {
+				t.Errorf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
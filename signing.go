@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/spf13/viper"
+
+	"github.com/ainghazal/torii/sign"
+)
+
+const headerSignature = "X-Torii-Signature"
+
+// signer signs the rendered descriptors. It is nil if no signing key is
+// configured.
+var signer *sign.Signer
+
+// initSigner loads the key configured with the signing_key_file key.
+// Descriptors are served unsigned if none is set.
+func initSigner() {
+	path := viper.GetString("signing_key_file")
+	if path == "" {
+		log.Println("WARN: no signing_key_file, descriptors will not be signed")
+		return
+	}
+	s, err := sign.LoadSigner(path)
+	if err != nil {
+		log.Fatal("ERROR: cannot load signing key: ", err)
+	}
+	signer = s
+	log.Println("🔏 Signing descriptors with key", s.JWK().Kid)
+}
+
+// signingKeyHandler publishes the public signing key as a JWK.
+func signingKeyHandler(w http.ResponseWriter, r *http.Request) {
+	if signer == nil {
+		http.Error(w, errNotFoundStr, http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/jwk+json")
+	json.NewEncoder(w).Encode(signer.JWK())
+}
+
+// bufferedResponse holds the body and the status of a response until it's
+// flushed, so that we can sign the body first. Headers go straight to the
+// underlying writer.
+type bufferedResponse struct {
+	w      http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header {
+	return b.w.Header()
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	return b.body.Write(p)
+}
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	if b.status == 0 {
+		b.status = status
+	}
+}
+
+// flush writes the buffered response, with a detached signature of the body
+// if it's a successful one and we have a signer.
+func (b *bufferedResponse) flush() {
+	if b.status == 0 {
+		b.status = http.StatusOK
+	}
+	if signer != nil && b.status == http.StatusOK {
+		b.w.Header().Set(headerSignature, signer.Sign(b.body.Bytes()))
+	}
+	b.w.WriteHeader(b.status)
+	b.w.Write(b.body.Bytes())
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+
+	"github.com/ainghazal/torii/share"
+	"github.com/ainghazal/torii/vpn"
+)
+
+const (
+	paramStrategy = "strategy"
+
+	defaultStrategy = "uniform"
+)
+
+// strategyParams are the inputs of a strategy, taken from the query string
+// or from an experiment.
+type strategyParams struct {
+	// CountryCode restricts the pool to one country, if not empty.
+	CountryCode string
+	// Max is the number of endpoints to pick. Zero means the default of
+	// the strategy.
+	Max int
+	// Filters are extra filters applied to the pool (e.g. asn).
+	Filters []namedFilter
+	// Extra holds strategy-specific parameters.
+	Extra url.Values
+}
+
+// maxOr returns Max, or def if Max is not set.
+func (sp strategyParams) maxOr(def int) int {
+	if sp.Max <= 0 {
+		return def
+	}
+	return sp.Max
+}
+
+// strategyParam documents a parameter accepted by a strategy.
+type strategyParam struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Default     string `json:"default,omitempty"`
+}
+
+// strategy is a named way of building an endpoint selector, chosen with
+// ?strategy=name or stored in an experiment. New strategies are added with
+// registerStrategy.
+type strategy struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Params      []strategyParam `json:"params"`
+
+	build func(strategyParams) (endpointSelectorFn, error)
+}
+
+var strategies = make(map[string]*strategy)
+
+func init() {
+	// let the experiments be checked against the registry
+	share.KnownStrategy = func(name string) bool {
+		_, ok := strategies[name]
+		return ok
+	}
+}
+
+// registerStrategy adds a strategy to the registry.
+func registerStrategy(s *strategy) {
+	if _, ok := strategies[s.Name]; ok {
+		log.Fatalf("strategy %s registered twice", s.Name)
+	}
+	strategies[s.Name] = s
+}
+
+// selectorForStrategy returns the selector built by the named strategy. An
+// empty name selects the default strategy. Max cannot be larger than the
+// limit for experiments (share.MaxEndpoints), since every pick costs work.
+func selectorForStrategy(name string, params strategyParams) (endpointSelectorFn, error) {
+	if name == "" {
+		name = defaultStrategy
+	}
+	s, ok := strategies[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown strategy: %q", name)
+	}
+	if params.Max > share.MaxEndpoints {
+		return nil, fmt.Errorf("%s must be at most %d", paramMax, share.MaxEndpoints)
+	}
+	return s.build(params)
+}
+
+// common parameters, shared by most strategies
+var (
+	paramDocCountry = strategyParam{Name: paramCountryCode, Description: "two-letter country code to restrict the pool to", Default: "any"}
+	paramDocASN     = strategyParam{Name: paramASN, Description: "autonomous system to restrict the pool to, e.g. AS1234"}
+	paramDocMax     = strategyParam{Name: paramMax, Description: fmt.Sprintf("number of endpoints to pick, at most %d", share.MaxEndpoints), Default: "1"}
+)
+
+func init() {
+	registerStrategy(&strategy{
+		Name:        "uniform",
+		Description: "picks endpoints at random from the whole pool, weighted by their health score",
+		Params:      []strategyParam{paramDocCountry, paramDocASN, paramDocMax},
+		build: func(sp strategyParams) (endpointSelectorFn, error) {
+			return byCountryEndpointPicker(sp.CountryCode, sp.maxOr(1), sp.Filters...), nil
+		},
+	})
+	registerStrategy(&strategy{
+		Name:        "per-country",
+		Description: "like uniform, but a country code is required",
+		Params:      []strategyParam{paramDocCountry, paramDocASN, paramDocMax},
+		build: func(sp strategyParams) (endpointSelectorFn, error) {
+			if sp.CountryCode == "" || sp.CountryCode == "any" {
+				return nil, fmt.Errorf("per-country needs a %s parameter", paramCountryCode)
+			}
+			return byCountryEndpointPicker(sp.CountryCode, sp.maxOr(1), sp.Filters...), nil
+		},
+	})
+	registerStrategy(&strategy{
+		Name:        "stratified",
+		Description: "picks one endpoint per country, weighted by health score, so that every country is represented",
+		Params: []strategyParam{paramDocASN, {
+			Name:        paramMax,
+			Description: "maximum number of countries; 0 means all of them",
+			Default:     "0",
+		}},
+		build: func(sp strategyParams) (endpointSelectorFn, error) {
+			return stratifiedEndpointPicker(sp.Max, sp.Filters...), nil
+		},
+	})
+	registerStrategy(&strategy{
+		Name:        "least-served",
+		Description: "picks the distinct endpoints served the least (and least recently), to cover the pool evenly",
+		Params:      []strategyParam{paramDocCountry, paramDocASN, paramDocMax},
+		build: func(sp strategyParams) (endpointSelectorFn, error) {
+			return leastServedEndpointPicker(sp.CountryCode, sp.maxOr(1), sp.Filters...), nil
+		},
+	})
+}
+
+// stratifiedEndpointPicker returns a provider selector that groups the
+// candidate endpoints by country, and picks one endpoint from each of them.
+// If max is positive, only max countries (chosen at random) are used.
+func stratifiedEndpointPicker(max int, extra ...namedFilter) endpointSelectorFn {
+	return func(p vpn.Provider, tr *selectionTrace) []*vpn.Endpoint {
+		byCountry := make(map[string][]*vpn.Endpoint)
+		countries := []string{}
+		for _, e := range candidateEndpoints(p, extra, tr) {
+			if _, ok := byCountry[e.CountryCode]; !ok {
+				countries = append(countries, e.CountryCode)
+			}
+			byCountry[e.CountryCode] = append(byCountry[e.CountryCode], e)
+		}
+		sort.Strings(countries)
+		rand.Shuffle(len(countries), func(i, j int) {
+			countries[i], countries[j] = countries[j], countries[i]
+		})
+		if max > 0 && max < len(countries) {
+			countries = countries[:max]
+		}
+		weight := healthWeight(p.Name())
+		res := []*vpn.Endpoint{}
+		for _, cc := range countries {
+			sel := byCountry[cc]
+			weights := make([]float64, len(sel))
+			for i, e := range sel {
+				weights[i] = weight(e)
+				tr.weigh(p.Name(), e, weights[i])
+			}
+			pick, roll := weightedPick(weights)
+			log.Printf("🎲 Picked endpoint %d/%d in %s\n", pick+1, len(sel), cc)
+			tr.draw(traceDraw{
+				Provider: p.Name(),
+				Kind:     "stratified",
+				Endpoint: traceEndpoint(sel[pick]),
+				Pool:     len(sel),
+				Roll:     roll,
+				Note:     "country " + cc,
+			})
+			res = append(res, sel[pick])
+		}
+		return res
+	}
+}
+
+// strategyParamsFromRequest reads the strategy parameters from the path and
+// the query string.
+func strategyParamsFromRequest(r *http.Request) strategyParams {
+	q := r.URL.Query()
+	cc := getParam(paramCountryCode, r)
+	if cc == "" {
+		cc = q.Get(paramCountryCode)
+	}
+	return strategyParams{
+		CountryCode: cc,
+		Max:         strToIntOrZero(q.Get(paramMax)),
+		Filters:     []namedFilter{byASNFilter(q.Get(paramASN))},
+		Extra:       q,
+	}
+}
+
+// strategyParamsFromExperiment reads the strategy parameters stored in an
+// experiment.
+func strategyParamsFromExperiment(exp *share.Experiment) strategyParams {
+	return strategyParams{
+		CountryCode: exp.CountryCode,
+		Max:         strToIntOrZero(exp.Max),
+		Extra: url.Values{
+			paramVariants: []string{exp.Variants},
+		},
+	}
+}
+
+// listStrategiesHandler documents all the registered strategies.
+func listStrategiesHandler(w http.ResponseWriter, r *http.Request) {
+	list := []*strategy{}
+	for _, s := range strategies {
+		list = append(list, s)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	json.NewEncoder(w).Encode(list)
+}
+
+func strToIntOrZero(s string) int {
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		return 0
+	}
+	return i
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/ainghazal/torii/share"
+)
+
+func Test_selectorForStrategy(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy string
+		max      int
+		wantErr  bool
+	}{
+		{"default strategy", "", 0, false},
+		{"at the limit", "uniform", share.MaxEndpoints, false},
+		{"above the limit", "uniform", share.MaxEndpoints + 1, true},
+		{"huge max", "least-served", 100000000, true},
+		{"unknown strategy", "nope", 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := selectorForStrategy(tt.strategy, strategyParams{Max: tt.max})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("selectorForStrategy() err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_knownStrategy(t *testing.T) {
+	for name := range strategies {
+		if !share.KnownStrategy(name) {
+			t.Errorf("registered strategy %s is unknown to share", name)
+		}
+	}
+	if share.KnownStrategy("nope") {
+		t.Errorf("unregistered strategy is known to share")
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/ainghazal/torii/sign"
+)
+
+// runVerify implements the verify subcommand, which checks the signature of
+// a saved descriptor. It returns the exit code.
+func runVerify(args []string) int {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	keyFrom := fs.String("key", "", "public key as a JWK: a file, or the https url of /.well-known/torii-signing-key")
+	sig := fs.String("sig", "", "detached signature, as served in the "+headerSignature+" header (default: read from FILE.jws)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: torii verify -key KEY [-sig SIG] FILE")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 || *keyFrom == "" {
+		fs.Usage()
+		return 2
+	}
+	path := fs.Arg(0)
+
+	payload, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "ERROR:", err)
+		return 1
+	}
+	jws := *sig
+	if jws == "" {
+		b, err := os.ReadFile(path + ".jws")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "ERROR:", err)
+			return 1
+		}
+		jws = strings.TrimSpace(string(b))
+	}
+	jwk, err := readJWK(*keyFrom)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "ERROR: cannot read key:", err)
+		return 1
+	}
+	if err := sign.Verify(jwk, payload, jws); err != nil {
+		fmt.Fprintln(os.Stderr, "FAIL:", err)
+		return 1
+	}
+	fmt.Printf("OK: %s signed by %s\n", path, jwk.Kid)
+	return 0
+}
+
+// readJWK reads a JWK from a file or an url.
+func readJWK(from string) (sign.JWK, error) {
+	var jwk sign.JWK
+	var r io.Reader
+	if strings.HasPrefix(from, "https://") || strings.HasPrefix(from, "http://") {
+		resp, err := http.Get(from)
+		if err != nil {
+			return jwk, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return jwk, fmt.Errorf("%s: %s", from, resp.Status)
+		}
+		r = resp.Body
+	} else {
+		f, err := os.Open(from)
+		if err != nil {
+			return jwk, err
+		}
+		defer f.Close()
+		r = f
+	}
+	err := json.NewDecoder(r).Decode(&jwk)
+	return jwk, err
+}
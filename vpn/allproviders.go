@@ -1,5 +1,7 @@
 package vpn
 
+import "strconv"
+
 // Endpoint is a single instance of any remote endpoint for a VPN Connection.
 type Endpoint struct {
 	Label       string
@@ -9,6 +11,38 @@ type Endpoint struct {
 	Transport   string
 	Obfuscation string
 	CountryCode string
+	// GeoCountryCode and ASN are filled from a local GeoIP database, if
+	// one is configured.
+	GeoCountryCode string
+	ASN            uint
+	// PairID groups matched variants of the same gateway in a paired
+	// selection. It is empty otherwise.
+	PairID string
+	// PublicKey and AllowedIPs are only used by WireGuard endpoints.
+	PublicKey  string
+	AllowedIPs string
+	// Origin is the endpoint in the pool of the provider, for endpoints
+	// that are modified copies of it (see Copy).
+	Origin *Endpoint `json:"-"`
+}
+
+// Copy returns a copy of the endpoint, to be modified for a single
+// descriptor. The copy is linked to the endpoint in the pool.
+func (e *Endpoint) Copy() *Endpoint {
+	c := *e
+	if c.Origin == nil {
+		c.Origin = e
+	}
+	return &c
+}
+
+// PoolEndpoint returns the endpoint in the pool of the provider that this
+// one is a copy of, or the endpoint itself.
+func (e *Endpoint) PoolEndpoint() *Endpoint {
+	if e.Origin != nil {
+		return e.Origin
+	}
+	return e
 }
 
 // Provider is the entity that runs endpoints.
@@ -21,11 +55,15 @@ type Provider interface {
 }
 
 // AuthDetails are generic credentials needed to authenticate with an endpoint.
-// At the moment only certificates are supported.
+// Certificates are used by OpenVPN endpoints. WireGuard endpoints use a
+// private key and the address the provider assigned to it.
 type AuthDetails struct {
 	Ca   string
 	Cert string
 	Key  string
+
+	WgPrivateKey string
+	WgAddress    string
 }
 
 // Providers is a map that allows to select providers by their name.
@@ -52,3 +90,19 @@ func IsKnownProvider(name string) bool {
 	}
 	return false
 }
+
+// KnownPorts returns the distinct ports used by the endpoints of a provider,
+// which we take as the ports the provider is known to accept.
+func KnownPorts(p Provider) []int {
+	seen := make(map[int]bool)
+	ports := []int{}
+	for _, e := range p.Endpoints() {
+		port, err := strconv.Atoi(e.Port)
+		if err != nil || seen[port] {
+			continue
+		}
+		seen[port] = true
+		ports = append(ports, port)
+	}
+	return ports
+}
@@ -4,9 +4,13 @@ import (
 	"encoding/base64"
 	"encoding/pem"
 	"errors"
+	"strings"
 )
 
+const base64Prefix = "base64:"
+
 var (
+	errNoBase64     = errors.New("missing base64: prefix")
 	errNoKey        = errors.New("cannot decode key")
 	errNoCert       = errors.New("cannot decode cert")
 	typePrivateKey  = "RSA PRIVATE KEY"
@@ -15,7 +19,19 @@ var (
 
 // toBase64 encodes a pem block as a base64: prefixed block.
 func toBase64(b []byte) string {
-	return "base64:" + base64.URLEncoding.EncodeToString(b)
+	return base64Prefix + base64.URLEncoding.EncodeToString(b)
+}
+
+// FromBase64 decodes a block encoded with toBase64. An empty string decodes
+// to an empty block.
+func FromBase64(s string) ([]byte, error) {
+	if s == "" {
+		return []byte{}, nil
+	}
+	if !strings.HasPrefix(s, base64Prefix) {
+		return nil, errNoBase64
+	}
+	return base64.URLEncoding.DecodeString(strings.TrimPrefix(s, base64Prefix))
 }
 
 func splitCombinedPEM(combined []byte) (key, cert []byte, err error) {
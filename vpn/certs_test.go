@@ -218,3 +218,16 @@ func Test_splitCombinedPEM(t *testing.T) {
 		})
 	}
 }
+
+func TestFromBase64(t *testing.T) {
+	got, err := FromBase64(toBase64([]byte(testCertPEM)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, []byte(testCertPEM)) {
+		t.Errorf("FromBase64() = %v, want %v", got, testCertPEM)
+	}
+	if _, err := FromBase64("Zm9v"); err != errNoBase64 {
+		t.Errorf("FromBase64() err = %v, want %v", err, errNoBase64)
+	}
+}
@@ -1,13 +1,20 @@
 package vpn
 
-// Options are the options for a vpn nettest
+// Options are the options for a vpn nettest.
+// The json names are part of the descriptor format (see
+// /schema/descriptor.json), and must not change.
 // TODO split for wireguard and openvpn.
 type Options struct {
-	Cipher         string
-	Auth           string
-	Compress       string
-	SafeCa         string
-	SafeCert       string
-	SafeKey        string
-	SafeLocalCreds bool
+	Cipher         string `json:"Cipher"`
+	Auth           string `json:"Auth"`
+	Compress       string `json:"Compress"`
+	SafeCa         string `json:"SafeCa"`
+	SafeCert       string `json:"SafeCert"`
+	SafeKey        string `json:"SafeKey"`
+	SafeLocalCreds bool   `json:"SafeLocalCreds"`
+	// CredentialsURL and CredentialsToken replace SafeCert and SafeKey in
+	// secret-free descriptors: the probe fetches the credentials from the
+	// url, with the token.
+	CredentialsURL   string `json:"CredentialsURL,omitempty"`
+	CredentialsToken string `json:"CredentialsToken,omitempty"`
 }
@@ -14,8 +14,6 @@ import (
 
 var (
 	riseupName = "riseup"
-	// port 53 is proving to be problematic
-	portsToAvoid = []int{53}
 )
 
 type RiseupProvider struct {
@@ -163,17 +161,13 @@ func fetchCertificateFromAPI() (AuthDetails, error) {
 	return auth, nil
 }
 
+// shouldAvoidPort returns true for ports we cannot parse. Exclusion of
+// problematic ports is done with rules at selection time.
 func shouldAvoidPort(port string) bool {
-	i, err := strconv.Atoi(port)
-	if err != nil {
-		log.Printf("WARN bad port %v", i)
+	if _, err := strconv.Atoi(port); err != nil {
+		log.Printf("WARN bad port %v", port)
 		return true
 	}
-	for _, p := range portsToAvoid {
-		if p == i {
-			return true
-		}
-	}
 	return false
 }
 
@@ -0,0 +1,97 @@
+package vpn
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"time"
+)
+
+// Snapshot is the state of a set of providers at a given time, so that
+// descriptors can be rendered again later, or offline, from the same pool.
+type Snapshot struct {
+	Taken     time.Time          `json:"taken"`
+	Providers []ProviderSnapshot `json:"providers"`
+}
+
+// ProviderSnapshot is the state of a single provider.
+type ProviderSnapshot struct {
+	Name      string      `json:"name"`
+	LongName  string      `json:"long_name"`
+	Auth      AuthDetails `json:"auth"`
+	Endpoints []*Endpoint `json:"endpoints"`
+}
+
+// TakeSnapshot returns a snapshot of the passed providers.
+func TakeSnapshot(providers map[string]Provider) *Snapshot {
+	s := &Snapshot{Taken: time.Now().UTC(), Providers: []ProviderSnapshot{}}
+	for _, p := range providers {
+		s.Providers = append(s.Providers, ProviderSnapshot{
+			Name:      p.Name(),
+			LongName:  p.LongName(),
+			Auth:      p.Auth(),
+			Endpoints: p.Endpoints(),
+		})
+	}
+	sort.Slice(s.Providers, func(i, j int) bool {
+		return s.Providers[i].Name < s.Providers[j].Name
+	})
+	return s
+}
+
+// LoadSnapshot reads a snapshot written by Save.
+func LoadSnapshot(path string) (*Snapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &Snapshot{}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Save writes the snapshot to a file.
+func (s *Snapshot) Save(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// Restore replaces the registered providers with the ones in the snapshot.
+func (s *Snapshot) Restore() {
+	for i := range s.Providers {
+		Providers[s.Providers[i].Name] = &snapshotProvider{&s.Providers[i]}
+	}
+}
+
+// snapshotProvider is a provider restored from a snapshot. It never
+// bootstraps.
+type snapshotProvider struct {
+	s *ProviderSnapshot
+}
+
+func (p *snapshotProvider) Name() string {
+	return p.s.Name
+}
+
+func (p *snapshotProvider) LongName() string {
+	return p.s.LongName
+}
+
+func (p *snapshotProvider) Bootstrap() bool {
+	return true
+}
+
+func (p *snapshotProvider) Endpoints() []*Endpoint {
+	return p.s.Endpoints
+}
+
+func (p *snapshotProvider) Auth() AuthDetails {
+	return p.s.Auth
+}
+
+var _ Provider = &snapshotProvider{}
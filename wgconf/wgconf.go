@@ -0,0 +1,95 @@
+// Package wgconf renders WireGuard configurations in the wg-quick format.
+package wgconf
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/curve25519"
+)
+
+// DefaultAllowedIPs routes all the traffic through the tunnel.
+const DefaultAllowedIPs = "0.0.0.0/0, ::/0"
+
+var errBadKey = errors.New("wgconf: bad key")
+
+// Interface is the local side of the tunnel.
+type Interface struct {
+	PrivateKey string
+	Address    string
+	DNS        string
+}
+
+// Peer is a remote WireGuard endpoint.
+type Peer struct {
+	PublicKey  string
+	Endpoint   string
+	AllowedIPs string
+}
+
+// Config is a wg-quick configuration with a single interface.
+type Config struct {
+	Interface Interface
+	Peers     []Peer
+}
+
+// WriteTo writes the config in the wg-quick format. If the address of the
+// interface is not known, a comment is written in its place, since the
+// address is assigned by the provider.
+func (c *Config) WriteTo(w io.Writer) (int64, error) {
+	buf := &bytes.Buffer{}
+	fmt.Fprintln(buf, "[Interface]")
+	fmt.Fprintf(buf, "PrivateKey = %s\n", c.Interface.PrivateKey)
+	if c.Interface.Address != "" {
+		fmt.Fprintf(buf, "Address = %s\n", c.Interface.Address)
+	} else {
+		fmt.Fprintln(buf, "# Address = <the address assigned by the provider>")
+	}
+	if c.Interface.DNS != "" {
+		fmt.Fprintf(buf, "DNS = %s\n", c.Interface.DNS)
+	}
+	for _, p := range c.Peers {
+		allowed := p.AllowedIPs
+		if allowed == "" {
+			allowed = DefaultAllowedIPs
+		}
+		fmt.Fprintln(buf)
+		fmt.Fprintln(buf, "[Peer]")
+		fmt.Fprintf(buf, "PublicKey = %s\n", p.PublicKey)
+		fmt.Fprintf(buf, "Endpoint = %s\n", p.Endpoint)
+		fmt.Fprintf(buf, "AllowedIPs = %s\n", allowed)
+	}
+	return buf.WriteTo(w)
+}
+
+// GenerateKey returns a new private key and its public key, both encoded in
+// base64 as expected by wg-quick.
+func GenerateKey() (private, public string, err error) {
+	var key [curve25519.ScalarSize]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		return "", "", err
+	}
+	// clamp, as done by wg genkey
+	key[0] &= 248
+	key[31] = (key[31] & 127) | 64
+	private = base64.StdEncoding.EncodeToString(key[:])
+	public, err = PublicKey(private)
+	return private, public, err
+}
+
+// PublicKey returns the public key for a base64-encoded private key.
+func PublicKey(private string) (string, error) {
+	key, err := base64.StdEncoding.DecodeString(private)
+	if err != nil || len(key) != curve25519.ScalarSize {
+		return "", errBadKey
+	}
+	pub, err := curve25519.X25519(key, curve25519.Basepoint)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(pub), nil
+}
@@ -0,0 +1,55 @@
+package wgconf
+
+import "testing"
+
+func TestPublicKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		private string
+		want    string
+		wantErr bool
+	}{
+		{
+			// from the curve25519 test vectors in RFC 7748, section 6.1
+			name:    "rfc 7748 alice",
+			private: "dwdtCnMYpX08FsFyUbJmRd9ML4frwJkqsXf7pR25LCo=",
+			want:    "hSDwCYkwp1R0i33ctD73Wg2/Og0mOBr066SpjqqbTmo=",
+		},
+		{
+			name:    "not base64",
+			private: "not a key",
+			wantErr: true,
+		},
+		{
+			name:    "short key",
+			private: "AAAA",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := PublicKey(tt.private)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("PublicKey() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("PublicKey() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateKey(t *testing.T) {
+	private, public, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := PublicKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != public {
+		t.Errorf("GenerateKey() public = %v, want %v", public, got)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"log"
+	"net"
+	"net/http"
+
+	"github.com/ainghazal/torii/vpn"
+	"github.com/ainghazal/torii/wgconf"
+)
+
+const contentTypeWireGuard = "application/x-wireguard-config"
+
+// wireGuardConfigs returns one wg-quick config for each WireGuard endpoint
+// behind a descriptor. The client key is the one in the credentials of the
+// provider, if any, or a new one generated for this request. A generated key
+// still has to be registered with the provider before it can be used.
+// Endpoints picked more than once get a single config.
+func wireGuardConfigs(cfg *config) ([]profileFile, error) {
+	files := []profileFile{}
+	seen := map[string]bool{}
+	for _, sel := range cfg.selected {
+		e := sel.endpoint
+		if e.Proto != "wg" {
+			log.Printf("WARN: skipping %s endpoint %s for wireguard config\n", e.Proto, e.IP)
+			continue
+		}
+		key := endpointKey(sel.provider.Name(), e)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		iface, err := wireGuardInterface(sel.provider.Auth())
+		if err != nil {
+			return nil, err
+		}
+		c := &wgconf.Config{
+			Interface: iface,
+			Peers: []wgconf.Peer{{
+				PublicKey:  e.PublicKey,
+				Endpoint:   net.JoinHostPort(e.IP, e.Port),
+				AllowedIPs: e.AllowedIPs,
+			}},
+		}
+		name := profileFileName("conf", sel.provider.Name(), e.IP, e.Port)
+		files = append(files, profileFile{name, c})
+	}
+	return files, nil
+}
+
+func wireGuardInterface(auth vpn.AuthDetails) (wgconf.Interface, error) {
+	if auth.WgPrivateKey != "" {
+		return wgconf.Interface{PrivateKey: auth.WgPrivateKey, Address: auth.WgAddress}, nil
+	}
+	private, _, err := wgconf.GenerateKey()
+	if err != nil {
+		return wgconf.Interface{}, err
+	}
+	return wgconf.Interface{PrivateKey: private, Address: auth.WgAddress}, nil
+}
+
+// writeWireGuardConfigs writes the descriptor as wg-quick configs (see
+// writeProfileFiles).
+func writeWireGuardConfigs(w http.ResponseWriter, r *http.Request, cfg *config) error {
+	files, err := wireGuardConfigs(cfg)
+	if err != nil {
+		return err
+	}
+	writeProfileFiles(w, files, contentTypeWireGuard)
+	return nil
+}
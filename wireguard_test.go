@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ainghazal/torii/vpn"
+)
+
+func Test_writeWireGuardConfigs(t *testing.T) {
+	openvpn := &vpn.Endpoint{IP: "192.0.2.1", Port: "1194", Proto: "openvpn", Transport: "udp"}
+	wg := &vpn.Endpoint{IP: "2001:db8::1", Port: "51820", Proto: "wg", Transport: "udp", PublicKey: "peerkey", AllowedIPs: "0.0.0.0/0"}
+
+	tests := []struct {
+		name      string
+		endpoints []*vpn.Endpoint
+		want      int
+		wantFile  string
+	}{
+		{"no wireguard endpoints", []*vpn.Endpoint{openvpn}, http.StatusNotFound, ""},
+		{"wireguard endpoint", []*vpn.Endpoint{openvpn, wg}, http.StatusOK, "riseup-2001_db8__1-51820.conf"},
+		{"picked twice", []*vpn.Endpoint{wg, wg}, http.StatusOK, "riseup-2001_db8__1-51820.conf"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := vpn.NewCustomProvider("riseup")
+			pick := func(vpn.Provider, *selectionTrace) []*vpn.Endpoint { return tt.endpoints }
+			cfg, err := renderConfigForProvider(p, pick, newDescriptorMeta("riseup", "", ""), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w := httptest.NewRecorder()
+			formats["wg"].write(w, httptest.NewRequest(http.MethodGet, "/", nil), cfg, nil, nil)
+			if w.Code != tt.want {
+				t.Fatalf("write() status = %d, want %d", w.Code, tt.want)
+			}
+			if tt.wantFile == "" {
+				return
+			}
+			if got := w.Header().Get("Content-Disposition"); !strings.Contains(got, tt.wantFile) {
+				t.Errorf("Content-Disposition = %s, want %s", got, tt.wantFile)
+			}
+			for _, want := range []string{"[Peer]", "PublicKey = peerkey", "Endpoint = [2001:db8::1]:51820"} {
+				if !strings.Contains(w.Body.String(), want) {
+					t.Errorf("config lacks %q:\n%s", want, w.Body.String())
+				}
+			}
+		})
+	}
+}